@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+
+	servicemanager "github.com/psyb0t/servicepack/internal/pkg/service-manager"
+	"github.com/psyb0t/servicepack/pkg/runner"
+)
+
+// Exit codes of the binary. They follow sysexits(3) where one fits;
+// 80 and up are servicepack's own. A service implementing
+// servicemanager.ExitCoder can exit with any other code.
+const (
+	exitFailure          = 1
+	exitCyclicDependency = 65 // EX_DATAERR
+	exitNoServices       = 66 // EX_NOINPUT
+	exitServiceFailed    = 70 // EX_SOFTWARE
+	exitConfig           = 78 // EX_CONFIG
+	exitPanic            = 80
+	exitShutdownTimeout  = 81
+	exitJobTimeout       = 82
+)
+
+// exitCode maps the error a command failed with to the code the
+// process exits with. A code the failed service chose wins; a panic
+// and a Stop that timed out are told apart from any other service
+// failure.
+func exitCode(err error) int {
+	var serviceErr *servicemanager.ServiceError
+
+	isServiceErr := errors.As(err, &serviceErr)
+
+	switch {
+	case err == nil:
+		return 0
+	case isServiceErr && serviceErr.ExitCode != 0:
+		return serviceErr.ExitCode
+	case errors.Is(err, runner.ErrShutdownTimeout),
+		errors.Is(err, servicemanager.ErrStopTimeout):
+		return exitShutdownTimeout
+	case errors.Is(err, servicemanager.ErrJobTimeout):
+		return exitJobTimeout
+	case errors.Is(err, servicemanager.ErrInvalidConfig),
+		errors.Is(err, runner.ErrInvalidConfig):
+		return exitConfig
+	case errors.Is(err, servicemanager.ErrCyclicDependency):
+		return exitCyclicDependency
+	case errors.Is(err, servicemanager.ErrNoEnabledServices):
+		return exitNoServices
+	case errors.Is(err, servicemanager.ErrServicePanic):
+		return exitPanic
+	case isServiceErr:
+		return exitServiceFailed
+	default:
+		return exitFailure
+	}
+}
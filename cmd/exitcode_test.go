@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/psyb0t/ctxerrors"
+	servicemanager "github.com/psyb0t/servicepack/internal/pkg/service-manager"
+	"github.com/psyb0t/servicepack/pkg/runner"
+	"github.com/stretchr/testify/assert"
+)
+
+var errTest = errors.New("test error")
+
+func TestExitCode(t *testing.T) {
+	serviceErr := func(err error, code int) error {
+		return ctxerrors.Wrap(&servicemanager.ServiceError{
+			Service:  "api",
+			Phase:    servicemanager.PhaseRun,
+			ExitCode: code,
+			Err:      err,
+		}, "run application")
+	}
+
+	testCases := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{
+			name: "success",
+		},
+		{
+			name: "unknown error",
+			err:  errTest,
+			want: exitFailure,
+		},
+		{
+			name: "service crash",
+			err:  serviceErr(errTest, 0),
+			want: exitServiceFailed,
+		},
+		{
+			name: "service panic",
+			err:  serviceErr(servicemanager.ErrServicePanic, 0),
+			want: exitPanic,
+		},
+		{
+			name: "code chosen by the service",
+			err:  serviceErr(servicemanager.ErrServicePanic, 3),
+			want: 3,
+		},
+		{
+			name: "shutdown timeout",
+			err:  runner.ErrShutdownTimeout,
+			want: exitShutdownTimeout,
+		},
+		{
+			name: "service stop timeout",
+			err: ctxerrors.Wrap(&servicemanager.ServiceError{
+				Service: "api",
+				Phase:   servicemanager.PhaseStop,
+				Err:     servicemanager.ErrStopTimeout,
+			}, "stop application"),
+			want: exitShutdownTimeout,
+		},
+		{
+			name: "job timeout",
+			err: ctxerrors.Wrap(
+				servicemanager.ErrJobTimeout, "run application",
+			),
+			want: exitJobTimeout,
+		},
+		{
+			name: "service manager config",
+			err:  servicemanager.ErrInvalidConfig,
+			want: exitConfig,
+		},
+		{
+			name: "runner config",
+			err:  runner.ErrInvalidConfig,
+			want: exitConfig,
+		},
+		{
+			name: "dependency cycle",
+			err: ctxerrors.Wrap(
+				servicemanager.ErrCyclicDependency, "resolve service order",
+			),
+			want: exitCyclicDependency,
+		},
+		{
+			name: "no enabled services",
+			err:  servicemanager.ErrNoEnabledServices,
+			want: exitNoServices,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, exitCode(tc.err))
+		})
+	}
+}
@@ -43,7 +43,7 @@ func main() {
 			"err", err,
 		)
 
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
 
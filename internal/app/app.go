@@ -21,9 +21,10 @@ type HookFunc func(ctx context.Context)
 
 type App struct {
 	wg             sync.WaitGroup
-	cancel         context.CancelFunc
+	cancel         context.CancelCauseFunc
 	cancelMu       sync.Mutex
 	stopOnce       sync.Once
+	stopErr        error
 	serviceManager *servicemanager.ServiceManager
 	preRunHooks    []HookFunc
 	postStopHooks  []HookFunc
@@ -65,11 +66,29 @@ func (a *App) OnPostStop(fn HookFunc) {
 	a.postStopHooks = append(a.postStopHooks, fn)
 }
 
+// Subscribe streams service lifecycle events. See
+// ServiceManager.Subscribe for buffering and delivery.
+func (a *App) Subscribe(buffer int) (<-chan servicemanager.Event, func()) {
+	return a.serviceManager.Subscribe(buffer)
+}
+
+// Observe calls observer for every service lifecycle event until
+// the returned function is called.
+func (a *App) Observe(observer servicemanager.Observer) func() {
+	return a.serviceManager.Observe(observer)
+}
+
+// Health reports how well the app and each of its services work.
+// See ServiceManager.Health.
+func (a *App) Health() servicemanager.HealthReport {
+	return a.serviceManager.Health()
+}
+
 func (a *App) Run(ctx context.Context) error {
 	ctxscope.GetLogger(ctx).Info("running app", "env", goenv.Get())
 
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
 
 	a.cancelMu.Lock()
 	a.cancel = cancel
@@ -91,8 +110,10 @@ func (a *App) Run(ctx context.Context) error {
 
 	defer a.wg.Wait()
 
+	// Stop cancels ctx before it stops the services, which must not
+	// get a Stop context that is done already.
 	defer func() {
-		if err := a.Stop(ctx); err != nil {
+		if err := a.Stop(context.WithoutCancel(ctx)); err != nil {
 			ctxscope.GetLogger(ctx).Error("failed to stop app", "err", err)
 		}
 	}()
@@ -119,11 +140,21 @@ func (a *App) Run(ctx context.Context) error {
 	}
 }
 
+// Stop cancels Run, with servicemanager.ErrShutdown as the cause
+// unless Run's context ended first, stops the services and runs the
+// post-stop hooks, once. It returns the services' Stop failures;
+// later calls return the same, so the runner sees them even after
+// Run stopped the app.
 func (a *App) Stop(ctx context.Context) error {
+	// Run's own Stop has no deadline and usually gets here first; the
+	// caller's deadline must still cut the drain short while this
+	// call waits for it.
+	defer a.serviceManager.LimitStop(ctx)()
+
 	a.cancelMu.Lock()
 
 	if a.cancel != nil {
-		a.cancel()
+		a.cancel(servicemanager.ErrShutdown)
 	}
 
 	a.cancelMu.Unlock()
@@ -132,7 +163,10 @@ func (a *App) Stop(ctx context.Context) error {
 		ctxscope.GetLogger(ctx).Info("stopping app")
 		defer ctxscope.GetLogger(ctx).Info("stopped app")
 
-		a.serviceManager.Stop(ctx)
+		if err := a.serviceManager.Stop(ctx); err != nil {
+			a.stopErr = ctxerrors.Wrap(err, "failed to stop services")
+		}
+
 		a.wg.Wait()
 
 		for _, hook := range a.postStopHooks {
@@ -140,5 +174,5 @@ func (a *App) Stop(ctx context.Context) error {
 		}
 	})
 
-	return nil
+	return a.stopErr
 }
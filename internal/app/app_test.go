@@ -160,6 +160,12 @@ func TestApp_Run(t *testing.T) {
 				err := failingApp.Run(ctx)
 				assert.Error(t, err)
 				assert.Contains(t, err.Error(), "failed to run app")
+
+				var serviceErr *servicemanager.ServiceError
+				require.ErrorAs(t, err, &serviceErr)
+				assert.Equal(t, "failing", serviceErr.Service)
+				assert.Equal(t, servicemanager.PhaseRun, serviceErr.Phase)
+				assert.ErrorIs(t, err, assert.AnError)
 			},
 			expectError: true,
 		},
@@ -195,6 +201,179 @@ func TestApp_Stop(t *testing.T) {
 		err = app.Stop(ctx)
 		assert.NoError(t, err)
 	})
+
+	t.Run("stop errors outlive run", func(t *testing.T) {
+		resetInstance()
+		servicemanager.ResetInstance()
+
+		svc := servicemanager.NewMockService("flusher").
+			WithStopError(errFlush)
+
+		app := &App{serviceManager: servicemanager.GetInstance()}
+		app.serviceManager.Add(svc)
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		done := make(chan error, 1)
+
+		go func() {
+			done <- app.Run(ctx)
+		}()
+
+		waitForRunningServices(t, []*servicemanager.MockService{svc})
+		cancel()
+
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+		case <-time.After(servicesRunningTimeout):
+			t.Fatal("app.Run() did not complete within timeout")
+		}
+
+		// Run stopped the app on its way out; the runner's own Stop
+		// still has to see the failure.
+		err := app.Stop(context.Background())
+		require.ErrorIs(t, err, errFlush)
+
+		var serviceErr *servicemanager.ServiceError
+		require.ErrorAs(t, err, &serviceErr)
+		assert.Equal(t, "flusher", serviceErr.Service)
+		assert.Equal(t, servicemanager.PhaseStop, serviceErr.Phase)
+	})
+}
+
+var errFlush = errors.New("flush buffers")
+
+// causeRecordingService reports why its Run context ended and what
+// its Stop context held at the time Stop was called.
+type causeRecordingService struct {
+	*servicemanager.TestService
+	cause   chan error
+	stopErr chan error
+}
+
+func (c *causeRecordingService) Run(ctx context.Context) error {
+	<-ctx.Done()
+	c.cause <- context.Cause(ctx)
+
+	return nil
+}
+
+func (c *causeRecordingService) Stop(ctx context.Context) error {
+	c.stopErr <- ctx.Err()
+
+	return nil
+}
+
+func TestApp_StopCause(t *testing.T) {
+	resetInstance()
+
+	svc := &causeRecordingService{
+		TestService: servicemanager.NewTestService("svc"),
+		cause:       make(chan error, 1),
+		stopErr:     make(chan error, 1),
+	}
+
+	app := &App{serviceManager: servicemanager.GetInstance()}
+	app.serviceManager.Add(svc)
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- app.Run(context.Background())
+	}()
+
+	require.Eventually(t, func() bool {
+		status := app.serviceManager.Status()
+
+		return len(status) == 1 &&
+			status[0].State == servicemanager.StateRunning
+	}, servicesRunningTimeout, servicesRunningPoll)
+
+	// The service learns why it was cancelled, and still gets a Stop
+	// context it can use.
+	require.NoError(t, app.Stop(context.Background()))
+	require.ErrorIs(t, <-svc.cause, servicemanager.ErrShutdown)
+	require.NoError(t, <-svc.stopErr)
+	require.NoError(t, <-done)
+}
+
+// blockingDrainService does not finish draining until release is
+// closed.
+type blockingDrainService struct {
+	*servicemanager.TestService
+	release chan struct{}
+}
+
+func (b *blockingDrainService) Drain(context.Context) error {
+	<-b.release
+
+	return nil
+}
+
+func TestApp_StopDeadlineCutsRunDrain(t *testing.T) {
+	t.Setenv("SERVICEMANAGER_DRAINTIMEOUT", "1h")
+
+	resetInstance()
+
+	svc := &blockingDrainService{
+		TestService: servicemanager.NewTestService("svc"),
+		release:     make(chan struct{}),
+	}
+	defer close(svc.release)
+
+	app := &App{serviceManager: servicemanager.GetInstance()}
+	app.serviceManager.Add(svc)
+
+	events, unsubscribe := app.Subscribe(64)
+	defer unsubscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() {
+		done <- app.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool {
+		status := app.serviceManager.Status()
+
+		return len(status) == 1 &&
+			status[0].State == servicemanager.StateRunning
+	}, servicesRunningTimeout, servicesRunningPoll)
+
+	// As on a signal, Run's context ends first, so Run's own Stop,
+	// which has no deadline, is the one draining.
+	cancel()
+
+	require.Eventually(t, func() bool {
+		select {
+		case event := <-events:
+			return event.Type == servicemanager.EventDrainStarted
+		default:
+			return false
+		}
+	}, servicesRunningTimeout, servicesRunningPoll)
+
+	stopCtx, cancelStop := context.WithTimeout(
+		context.Background(), 20*time.Millisecond,
+	)
+	defer cancelStop()
+
+	stopDone := make(chan error, 1)
+
+	go func() {
+		stopDone <- app.Stop(stopCtx)
+	}()
+
+	select {
+	case err := <-stopDone:
+		require.NoError(t, err)
+	case <-time.After(servicesRunningTimeout):
+		t.Fatal("the Stop deadline did not cut the drain short")
+	}
+
+	require.NoError(t, <-done)
 }
 
 func TestApp_GetInstance(t *testing.T) {
@@ -547,3 +726,24 @@ func TestApp_PostStopHooks(t *testing.T) {
 		assert.Equal(t, []string{"cleanup1", "cleanup2"}, order)
 	})
 }
+
+func TestApp_Observe(t *testing.T) {
+	resetInstance()
+
+	a := createTestApp()
+
+	var started atomic.Int32
+
+	unobserve := a.Observe(servicemanager.ObserverFunc(
+		func(event servicemanager.Event) {
+			if event.Type == servicemanager.EventStarted {
+				started.Add(1)
+			}
+		},
+	))
+
+	runAppBriefly(t, a)
+	unobserve()
+
+	assert.Equal(t, int32(2), started.Load())
+}
@@ -0,0 +1,141 @@
+package servicemanager
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Jitter selects how ExponentialBackoff randomizes its delays.
+type Jitter int
+
+const (
+	// NoJitter waits the exponential delay as computed.
+	NoJitter Jitter = iota
+	// FullJitter waits a uniformly random delay between zero and
+	// the exponential delay, so failing instances spread out.
+	FullJitter
+)
+
+const (
+	defaultBackoffMultiplier = 2
+	decorrelatedGrowth       = 3
+	defaultRestartDelay      = 100 * time.Millisecond
+	defaultMaxRestartDelay   = 10 * time.Second
+)
+
+// ExponentialBackoff waits Base before the first retry and
+// Multiplier times longer before each retry after it, never more
+// than Max. A Multiplier below 1 means 2; a non-positive Max means
+// no cap.
+type ExponentialBackoff struct {
+	Base       time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     Jitter
+}
+
+func (b ExponentialBackoff) NextDelay(attempt int, _ error) time.Duration {
+	if b.Base <= 0 {
+		return 0
+	}
+
+	multiplier := b.Multiplier
+	if multiplier < 1 {
+		multiplier = defaultBackoffMultiplier
+	}
+
+	delay := float64(b.Base) * math.Pow(multiplier, float64(max(attempt-1, 0)))
+
+	capped := time.Duration(math.MaxInt64)
+	if delay < float64(math.MaxInt64) {
+		capped = time.Duration(delay)
+	}
+
+	if b.Max > 0 {
+		capped = min(capped, b.Max)
+	}
+
+	if b.Jitter == FullJitter && capped > 0 {
+		return randomDelay(capped)
+	}
+
+	return capped
+}
+
+// DecorrelatedJitter waits a random delay between Base and three
+// times its previous delay (Base before the first retry), never
+// more than Max; a non-positive Max means no cap. It remembers
+// the previous delay, so return a new one from every RetryBackoff
+// call.
+type DecorrelatedJitter struct {
+	Base time.Duration
+	Max  time.Duration
+	prev time.Duration
+}
+
+func (b *DecorrelatedJitter) NextDelay(int, error) time.Duration {
+	if b.Base <= 0 {
+		return 0
+	}
+
+	prev := max(b.prev, b.Base)
+
+	upper := prev * decorrelatedGrowth
+	if upper/decorrelatedGrowth != prev {
+		upper = time.Duration(math.MaxInt64)
+	}
+
+	if b.Max > 0 {
+		upper = min(upper, b.Max)
+	}
+
+	delay := upper
+	if upper > b.Base {
+		delay = b.Base + randomDelay(upper-b.Base+1)
+	}
+
+	b.prev = max(delay, b.Base)
+
+	return delay
+}
+
+// randomDelay returns a uniformly random delay in [0, n).
+func randomDelay(n time.Duration) time.Duration {
+	return rand.N(n) //nolint:gosec // jitter needs no crypto randomness
+}
+
+// retryDelayBackoff adapts a Retryable without its own Backoff:
+// every retry waits RetryDelay.
+type retryDelayBackoff struct {
+	retryable Retryable
+}
+
+func (b retryDelayBackoff) NextDelay(int, error) time.Duration {
+	return b.retryable.RetryDelay()
+}
+
+// retryBackoff returns the Backoff a run of service restarts with.
+// A service that is neither Retryable nor RetryBackoffer is only
+// restarted under RestartAlways; it backs off exponentially from
+// defaultRestartDelay, so a Run that returns at once cannot spin.
+//
+//nolint:ireturn
+func retryBackoff(service Service) Backoff {
+	rb, ok := service.(RetryBackoffer)
+	if ok {
+		if backoff := rb.RetryBackoff(); backoff != nil {
+			return backoff
+		}
+	}
+
+	retryable, ok := service.(Retryable)
+	if ok {
+		return retryDelayBackoff{retryable: retryable}
+	}
+
+	return ExponentialBackoff{
+		Base: defaultRestartDelay,
+		Max:  defaultMaxRestartDelay,
+	}
+}
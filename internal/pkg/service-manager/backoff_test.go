@@ -0,0 +1,167 @@
+package servicemanager
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	errFirst  = errors.New("first")
+	errSecond = errors.New("second")
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	testCases := []struct {
+		name    string
+		backoff ExponentialBackoff
+		want    []time.Duration
+	}{
+		{
+			name: "doubles up to max",
+			backoff: ExponentialBackoff{
+				Base: 100 * time.Millisecond,
+				Max:  time.Second,
+			},
+			want: []time.Duration{
+				100 * time.Millisecond,
+				200 * time.Millisecond,
+				400 * time.Millisecond,
+				800 * time.Millisecond,
+				time.Second,
+				time.Second,
+			},
+		},
+		{
+			name: "custom multiplier",
+			backoff: ExponentialBackoff{
+				Base:       time.Second,
+				Multiplier: 3,
+			},
+			want: []time.Duration{
+				time.Second, 3 * time.Second, 9 * time.Second,
+			},
+		},
+		{
+			name:    "zero base never waits",
+			backoff: ExponentialBackoff{Max: time.Second},
+			want:    []time.Duration{0, 0, 0},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for i, want := range tc.want {
+				assert.Equal(t, want, tc.backoff.NextDelay(i+1, errTestService),
+					"attempt %d", i+1)
+			}
+		})
+	}
+
+	t.Run("uncapped growth saturates", func(t *testing.T) {
+		backoff := ExponentialBackoff{Base: time.Second}
+
+		assert.Equal(t,
+			time.Duration(math.MaxInt64), backoff.NextDelay(500, nil))
+	})
+
+	t.Run("full jitter stays under the exponential delay", func(t *testing.T) {
+		backoff := ExponentialBackoff{
+			Base:   100 * time.Millisecond,
+			Max:    time.Second,
+			Jitter: FullJitter,
+		}
+
+		for attempt := 1; attempt <= 6; attempt++ {
+			ceiling := min(
+				100*time.Millisecond<<(attempt-1), time.Second,
+			)
+
+			for range 100 {
+				delay := backoff.NextDelay(attempt, nil)
+				assert.GreaterOrEqual(t, delay, time.Duration(0))
+				assert.Less(t, delay, ceiling)
+			}
+		}
+	})
+}
+
+func TestDecorrelatedJitter(t *testing.T) {
+	backoff := &DecorrelatedJitter{
+		Base: 10 * time.Millisecond,
+		Max:  time.Second,
+	}
+
+	prev := backoff.Base
+
+	for attempt := 1; attempt <= 200; attempt++ {
+		delay := backoff.NextDelay(attempt, nil)
+
+		assert.GreaterOrEqual(t, delay, backoff.Base)
+		assert.LessOrEqual(t, delay, min(3*prev, backoff.Max))
+
+		prev = delay
+	}
+
+	assert.Zero(t, (&DecorrelatedJitter{}).NextDelay(1, nil))
+}
+
+// recordingBackoff records what the manager asks it and never
+// waits.
+type recordingBackoff struct {
+	mu       sync.Mutex
+	attempts []int
+	errs     []error
+}
+
+func (b *recordingBackoff) NextDelay(attempt int, err error) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.attempts = append(b.attempts, attempt)
+	b.errs = append(b.errs, err)
+
+	return 0
+}
+
+type backoffMockService struct {
+	*RetryableMockService
+	backoff Backoff
+}
+
+func (b *backoffMockService) RetryBackoff() Backoff {
+	return b.backoff
+}
+
+func TestServiceManager_RetryBackoff(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	backoff := &recordingBackoff{}
+
+	svc := &backoffMockService{
+		RetryableMockService: NewRetryableMockService("backoff", 2).
+			WithRetryDelay(time.Hour),
+		backoff: backoff,
+	}
+	svc.WithRunErrors(errFirst, errSecond)
+
+	sm.Add(svc)
+
+	runDone, cancel := runInBackground(t, sm)
+
+	waitForState(t, sm, "backoff", StateRunning)
+	cancel()
+
+	require.NoError(t, waitForRun(t, runDone))
+
+	assert.Equal(t, []int{1, 2}, backoff.attempts)
+	assert.Equal(t, []error{errFirst, errSecond}, backoff.errs)
+	assert.Equal(t, 3, svc.RunCount())
+}
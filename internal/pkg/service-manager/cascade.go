@@ -0,0 +1,383 @@
+package servicemanager
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/psyb0t/ctxscope"
+)
+
+// DependencyLossPolicy decides what happens to a running service
+// when a service it depends on fails, or exits to be restarted.
+type DependencyLossPolicy string
+
+const (
+	// CancelOnDependencyLoss cancels the running attempt's context
+	// with a *DependencyLostError cause, waits until the dependency
+	// is ready again and calls Run again. It is the default.
+	CancelOnDependencyLoss DependencyLossPolicy = "cancel"
+	// RestartOnDependencyLoss does the same, but stops the service
+	// and starts a fresh instance from its factory.
+	RestartOnDependencyLoss DependencyLossPolicy = "restart"
+	// IgnoreDependencyLoss keeps the service running.
+	IgnoreDependencyLoss DependencyLossPolicy = "ignore"
+)
+
+func dependencyLossPolicy(service Service) DependencyLossPolicy {
+	h, ok := service.(DependencyLossHandler)
+	if !ok || h.DependencyLossPolicy() == "" {
+		return CancelOnDependencyLoss
+	}
+
+	return h.DependencyLossPolicy()
+}
+
+// availability tracks whether a run can be depended upon right
+// now. Each attempt is a new generation that is up once ready and
+// down, and ended, once it has ended; gone marks a run that will
+// not come back.
+// A clean exit that is not restarted leaves the run up: its work is
+// done. changed is closed and replaced on every transition.
+type availability struct {
+	mu      sync.Mutex
+	gen     int
+	up      bool
+	ended   bool
+	gone    bool
+	err     error
+	changed chan struct{}
+}
+
+// availabilityState is a snapshot of an availability.
+type availabilityState struct {
+	gen     int
+	up      bool
+	ended   bool
+	gone    bool
+	err     error
+	changed <-chan struct{}
+}
+
+func newAvailability() *availability {
+	return &availability{changed: make(chan struct{})}
+}
+
+// begin starts an attempt and returns its generation.
+func (a *availability) begin() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.gen++
+	a.up = false
+	a.ended = false
+	a.notify()
+
+	return a.gen
+}
+
+// markUp records that the attempt of generation gen is ready,
+// unless a later one has begun since.
+func (a *availability) markUp(gen int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if gen != a.gen || a.up || a.gone {
+		return
+	}
+
+	a.up = true
+	a.notify()
+}
+
+// markDown records that the current attempt ended with err.
+func (a *availability) markDown(err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.up = false
+	a.ended = true
+	a.err = err
+	a.notify()
+}
+
+// markGone records that the run ended for good with err.
+func (a *availability) markGone(err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.up = false
+	a.ended = true
+	a.gone = true
+	a.err = err
+	a.notify()
+}
+
+func (a *availability) state() availabilityState {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return availabilityState{
+		gen:     a.gen,
+		up:      a.up,
+		ended:   a.ended,
+		gone:    a.gone,
+		err:     a.err,
+		changed: a.changed,
+	}
+}
+
+// notify wakes everyone waiting for a transition. Callers hold mu.
+func (a *availability) notify() {
+	close(a.changed)
+	a.changed = make(chan struct{})
+}
+
+// runAttempt makes one Run call, or follows the schedule of a
+// Scheduled service, polling a HealthReporter while it runs. Its
+// context is cancelled with a *DependencyLostError cause when a
+// dependency goes down while it runs, unless the service ignores
+// that; the loss is returned when that is what ended the attempt.
+func (s *ServiceManager) runAttempt(
+	ctx context.Context,
+	run *serviceRun,
+) (*DependencyLostError, error) {
+	attemptCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	gen := run.avail.begin()
+
+	rn, ok := run.service.(ReadyNotifier)
+	if ok {
+		s.wg.Go(func() {
+			select {
+			case <-rn.Ready():
+				run.avail.markUp(gen)
+			case <-attemptCtx.Done():
+			}
+		})
+	} else {
+		run.avail.markUp(gen)
+	}
+
+	if hr, ok := run.service.(HealthReporter); ok {
+		s.wg.Go(func() {
+			s.pollHealth(attemptCtx, run.name, hr)
+		})
+	}
+
+	if dependencyLossPolicy(run.service) != IgnoreDependencyLoss {
+		for _, set := range s.dependencySets(run.deps) {
+			s.wg.Go(func() {
+				if set.replicated() {
+					s.watchQuorum(attemptCtx, run.name, set, cancel)
+
+					return
+				}
+
+				s.watchDependency(attemptCtx, run.name, set.name, cancel)
+			})
+		}
+	}
+
+	var err error
+
+	if sc, ok := run.service.(Scheduled); ok {
+		err = s.runSchedule(attemptCtx, run, sc)
+	} else {
+		err = s.safeRun(attemptCtx, run.name, run.service)
+	}
+
+	var lost *DependencyLostError
+	if ctx.Err() == nil && errors.As(context.Cause(attemptCtx), &lost) {
+		return lost, err
+	}
+
+	return nil, err
+}
+
+// watchDependency cancels an attempt of dependent once the attempt
+// of dep it started against goes down. A run replaced meanwhile, by
+// a restart through the control API, is watched from once it is up.
+func (s *ServiceManager) watchDependency(
+	ctx context.Context,
+	dependent string,
+	dep string,
+	cancel context.CancelCauseFunc,
+) {
+	var (
+		watched *serviceRun
+		gen     int
+	)
+
+	for first := true; ; first = false {
+		s.runsMu.Lock()
+		run, changed := s.runs[dep], s.runsChanged
+		s.runsMu.Unlock()
+
+		if run == nil {
+			return
+		}
+
+		if run != watched {
+			watched, gen = run, 0
+		}
+
+		state := run.avail.state()
+
+		switch {
+		case state.up && gen == 0:
+			gen = state.gen
+		case state.up && state.gen == gen:
+		case gen != 0 || first:
+			cancel(&DependencyLostError{
+				Service:    dependent,
+				Dependency: dep,
+				Err:        state.err,
+			})
+
+			return
+		}
+
+		select {
+		case <-state.changed:
+		case <-changed:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// dependencyLost handles an attempt that a lost dependency ended
+// and reports whether Run is called again. The attempt goes down
+// like any other, so the loss cascades to the service's own
+// dependents.
+func (s *ServiceManager) dependencyLost(
+	ctx context.Context,
+	run *serviceRun,
+	attempt int,
+	lost *DependencyLostError,
+) (bool, error) {
+	ctxscope.GetLogger(ctx).Warn("dependency lost, waiting for it",
+		"dependency", lost.Dependency,
+		"attempt", attempt,
+		"err", lost.Err,
+	)
+
+	run.avail.markDown(lost)
+	s.status.waiting(run.name, lost)
+	s.emit(Event{
+		Type:       EventDependencyLost,
+		Service:    run.name,
+		Dependency: lost.Dependency,
+		Attempt:    attempt,
+		Err:        lost,
+	})
+
+	if dependencyLossPolicy(run.service) == RestartOnDependencyLoss {
+		s.handOffRestart(run, resumption{
+			reason: RestartReasonDependencyLost,
+			err:    lost,
+		})
+
+		return false, nil
+	}
+
+	ready, err := s.waitDependencies(ctx, run)
+	if err != nil {
+		ctxscope.GetLogger(ctx).Error("service failed",
+			"attempts", attempt,
+			"err", err,
+		)
+
+		run.avail.markGone(err)
+		s.handleServiceError(ctx, run, run.failure(attempt, err))
+
+		return false, err
+	}
+
+	return ready, nil
+}
+
+// waitDependencies blocks until every dependency of run is ready,
+// a replicated one once its quorum is. It returns false when the
+// context ends first, and a *DependencyLostError when a dependency
+// is gone for good.
+func (s *ServiceManager) waitDependencies(
+	ctx context.Context,
+	run *serviceRun,
+) (bool, error) {
+	for _, set := range s.dependencySets(run.deps) {
+		ctxscope.GetLogger(
+			withServiceScope(ctx, run.name),
+		).Debug("waiting for dependency", "dependency", set.name)
+
+		var (
+			ready bool
+			err   error
+		)
+
+		if set.replicated() {
+			ready, err = s.waitQuorum(ctx, run.name, set)
+		} else {
+			ready, err = s.waitDependencyReady(ctx, run.name, set.name)
+		}
+
+		if !ready {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// waitDependencyReady blocks until the current run of name is
+// ready and its current attempt is up. A run replaced while
+// waiting (a restart) is looked up again, so dependents gate on the
+// new instance. A run that never became ready is left to its
+// readiness gate, unless it never launched because it lost a
+// dependency of its own.
+func (s *ServiceManager) waitDependencyReady(
+	ctx context.Context,
+	dependent string,
+	name string,
+) (bool, error) {
+	for {
+		s.runsMu.Lock()
+		run, changed := s.runs[name], s.runsChanged
+		launched := run.launched
+		s.runsMu.Unlock()
+
+		state := run.avail.state()
+		ready := run.ready
+
+		select {
+		case <-ready:
+			if state.up {
+				return true, nil
+			}
+
+			ready = nil
+		default:
+			if launched {
+				state.gone = false
+			}
+		}
+
+		if state.gone {
+			return false, &DependencyLostError{
+				Service:    dependent,
+				Dependency: name,
+				Err:        state.err,
+			}
+		}
+
+		select {
+		case <-ready:
+		case <-state.changed:
+		case <-changed:
+		case <-ctx.Done():
+			return false, nil
+		}
+	}
+}
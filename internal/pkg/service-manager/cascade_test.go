@@ -0,0 +1,220 @@
+package servicemanager
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lossRecordingService runs until cancelled and records why its
+// context was cancelled.
+type lossRecordingService struct {
+	Service
+	deps    []string
+	policy  DependencyLossPolicy
+	allowed bool
+	runs    atomic.Int32
+	mu      sync.Mutex
+	causes  []error
+}
+
+func newLossRecordingService(
+	name string,
+	policy DependencyLossPolicy,
+	deps ...string,
+) *lossRecordingService {
+	return &lossRecordingService{
+		Service: NewTestService(name),
+		deps:    deps,
+		policy:  policy,
+	}
+}
+
+func (l *lossRecordingService) Run(ctx context.Context) error {
+	l.runs.Add(1)
+
+	<-ctx.Done()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.causes = append(l.causes, context.Cause(ctx))
+
+	return nil
+}
+
+func (l *lossRecordingService) Dependencies() []string { return l.deps }
+
+func (l *lossRecordingService) DependencyLossPolicy() DependencyLossPolicy {
+	return l.policy
+}
+
+func (l *lossRecordingService) IsAllowedFailure() bool { return l.allowed }
+
+func (l *lossRecordingService) firstCause() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.causes) == 0 {
+		return nil
+	}
+
+	return l.causes[0]
+}
+
+func TestServiceManager_DependencyLossCancelsAndRegates(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	crash := make(chan struct{})
+	db := &crashingService{Service: NewTestService("db"), crash: crash}
+	api := newLossRecordingService("api", "", "db")
+
+	sm.Add(db, api)
+
+	stop := runControlled(t, sm, 2)
+	defer stop()
+
+	require.Eventually(t, func() bool {
+		return api.runs.Load() == 1
+	}, runHangGuard, startedPollInterval)
+
+	close(crash)
+
+	require.Eventually(t, func() bool {
+		return api.runs.Load() == 2
+	}, runHangGuard, startedPollInterval)
+
+	cause := api.firstCause()
+	require.ErrorIs(t, cause, ErrDependencyLost)
+	require.ErrorIs(t, cause, errTestService)
+
+	var lost *DependencyLostError
+	require.ErrorAs(t, cause, &lost)
+	assert.Equal(t, "api", lost.Service)
+	assert.Equal(t, "db", lost.Dependency)
+
+	status := waitForState(t, sm, "api", StateRunning)
+	assert.Equal(t, 1, status.Attempt)
+	assert.Equal(t, 1, status.Restarts)
+}
+
+// doomedService crashes once, like crashingService, but is never
+// retried and is allowed to fail.
+type doomedService struct {
+	*crashingService
+}
+
+func (d *doomedService) MaxRetries() int { return 0 }
+
+func (d *doomedService) IsAllowedFailure() bool { return true }
+
+func TestServiceManager_DependencyGoneFailsDependents(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	crash := make(chan struct{})
+	db := &doomedService{
+		crashingService: &crashingService{
+			Service: NewTestService("db"),
+			crash:   crash,
+		},
+	}
+
+	// cache is allowed to fail, so only the failure of web, two hops
+	// from db, ends Run.
+	cache := newLossRecordingService("cache", "", "db")
+	cache.allowed = true
+	web := newLossRecordingService("web", "", "cache")
+
+	sm.Add(db, cache, web)
+
+	runDone, cancel := runInBackground(t, sm)
+	defer cancel()
+
+	waitForStartedServices(t, sm, 3)
+	close(crash)
+
+	err := waitForRun(t, runDone)
+	require.ErrorIs(t, err, ErrDependencyLost)
+	require.ErrorIs(t, err, errTestService)
+
+	var lost *DependencyLostError
+	require.ErrorAs(t, err, &lost)
+	assert.Equal(t, "web", lost.Service)
+	assert.Equal(t, "cache", lost.Dependency)
+
+	for _, status := range sm.Status() {
+		if status.Name == "cache" {
+			assert.Equal(t, StateAllowedFailed, status.State)
+		}
+	}
+}
+
+func TestServiceManager_DependencyLossIgnored(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	crash := make(chan struct{})
+	db := &crashingService{Service: NewTestService("db"), crash: crash}
+	api := newLossRecordingService("api", IgnoreDependencyLoss, "db")
+
+	sm.Add(db, api)
+
+	stop := runControlled(t, sm, 2)
+	defer stop()
+
+	close(crash)
+
+	require.Eventually(t, func() bool {
+		for _, status := range sm.Status() {
+			if status.Name == "db" {
+				return status.Attempt == 2
+			}
+		}
+
+		return false
+	}, runHangGuard, startedPollInterval)
+
+	assert.Equal(t, int32(1), api.runs.Load())
+	assert.NoError(t, api.firstCause())
+}
+
+func TestServiceManager_DependencyLossRestarts(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	crash := make(chan struct{})
+	db := &crashingService{Service: NewTestService("db"), crash: crash}
+	sm.Add(db)
+
+	var built atomic.Int32
+
+	sm.Register("api", func() (Service, error) {
+		built.Add(1)
+
+		return newLossRecordingService(
+			"api", RestartOnDependencyLoss, "db",
+		), nil
+	})
+
+	stop := runControlled(t, sm, 2)
+	defer stop()
+
+	close(crash)
+
+	require.Eventually(t, func() bool {
+		return built.Load() == 2
+	}, runHangGuard, startedPollInterval)
+
+	status := waitForState(t, sm, "api", StateRunning)
+	assert.Equal(t, 1, status.Attempt)
+}
@@ -0,0 +1,172 @@
+package servicemanager
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fatalService crashes once, like crashingService, and is never
+// retried, so its failure ends Run.
+type fatalService struct {
+	*crashingService
+}
+
+func (f *fatalService) MaxRetries() int { return 0 }
+
+// stopRecordingService reports the error its Stop context already
+// held when Stop was called.
+type stopRecordingService struct {
+	*lossRecordingService
+	stopErr chan error
+}
+
+func (s *stopRecordingService) Stop(ctx context.Context) error {
+	s.stopErr <- ctx.Err()
+
+	return nil
+}
+
+func waitForCause(t *testing.T, l *lossRecordingService) error {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		return l.firstCause() != nil
+	}, runHangGuard, startedPollInterval,
+		"%s was never cancelled", l.Name())
+
+	return l.firstCause()
+}
+
+func TestServiceManager_ShutdownCause(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	svc := newLossRecordingService("svc", "")
+	sm.Add(svc)
+
+	stop := runControlled(t, sm, 1)
+	defer stop()
+
+	require.NoError(t, sm.Stop(t.Context()))
+	require.ErrorIs(t, waitForCause(t, svc), ErrShutdown)
+}
+
+func TestServiceManager_SiblingFailedCause(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	crash := make(chan struct{})
+	db := &fatalService{
+		crashingService: &crashingService{
+			Service: NewTestService("db"),
+			crash:   crash,
+		},
+	}
+	api := &stopRecordingService{
+		lossRecordingService: newLossRecordingService(
+			"api", IgnoreDependencyLoss,
+		),
+		stopErr: make(chan error, 1),
+	}
+
+	sm.Add(db, api)
+
+	runDone, cancel := runInBackground(t, sm)
+	defer cancel()
+
+	waitForStartedServices(t, sm, 2)
+	close(crash)
+
+	require.ErrorIs(t, waitForRun(t, runDone), errTestService)
+
+	cause := api.firstCause()
+	require.ErrorIs(t, cause, ErrSiblingFailed)
+	require.ErrorIs(t, cause, errTestService)
+
+	var sibling *SiblingError
+	require.ErrorAs(t, cause, &sibling)
+	assert.Equal(t, "db", sibling.Service)
+
+	// Run stopped the services itself, after cancelling them.
+	require.NoError(t, <-api.stopErr)
+}
+
+func TestServiceManager_ControlCauses(t *testing.T) {
+	testCases := []struct {
+		name    string
+		control func(context.Context, *ServiceManager) error
+		want    error
+	}{
+		{
+			name: "stop",
+			control: func(ctx context.Context, sm *ServiceManager) error {
+				return sm.StopService(ctx, "svc")
+			},
+			want: ErrStopRequested,
+		},
+		{
+			name: "restart",
+			control: func(ctx context.Context, sm *ServiceManager) error {
+				return sm.RestartService(ctx, "svc")
+			},
+			want: ErrRestartRequested,
+		},
+		{
+			name: "remove",
+			control: func(ctx context.Context, sm *ServiceManager) error {
+				return sm.RemoveService(ctx, "svc")
+			},
+			want: ErrStopRequested,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ResetInstance()
+
+			sm := GetInstance()
+
+			svc := newLossRecordingService("svc", "")
+			sm.Add(svc, NewTestService("other"))
+
+			stop := runControlled(t, sm, 2)
+			defer stop()
+
+			require.NoError(t, tc.control(t.Context(), sm))
+			require.ErrorIs(t, waitForCause(t, svc), tc.want)
+		})
+	}
+}
+
+func TestServiceManager_RestartedWithSiblingCause(t *testing.T) {
+	t.Setenv("SERVICEMANAGER_STRATEGY", string(OneForAll))
+
+	ResetInstance()
+
+	sm := GetInstance()
+
+	crash := make(chan struct{})
+	cache := newLossRecordingService("cache", "")
+	sm.Add(
+		&crashingService{Service: NewTestService("db"), crash: crash},
+		cache,
+	)
+
+	stop := runControlled(t, sm, 2)
+	defer stop()
+
+	close(crash)
+
+	cause := waitForCause(t, cache)
+	require.ErrorIs(t, cause, ErrRestartedWithSibling)
+	require.ErrorIs(t, cause, errTestService)
+
+	var sibling *SiblingError
+	require.ErrorAs(t, cause, &sibling)
+	assert.Equal(t, "db", sibling.Service)
+}
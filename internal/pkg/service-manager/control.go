@@ -0,0 +1,721 @@
+package servicemanager
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/psyb0t/ctxerrors"
+	"github.com/psyb0t/ctxscope"
+)
+
+// StartService starts a fresh instance of a service that is not
+// running, then waits until it is ready. The instance comes from
+// the registered factory; a service added without one is reused.
+// Its in-process dependencies must already be running.
+func (s *ServiceManager) StartService(
+	ctx context.Context,
+	name string,
+) error {
+	s.controlMu.Lock()
+	defer s.controlMu.Unlock()
+
+	run, err := s.liveRun(name)
+	if err != nil {
+		return err
+	}
+
+	if s.isActive(run) {
+		if !run.hasExited() {
+			return ctxerrors.Wrapf(ErrServiceRunning, "%s", name)
+		}
+
+		// It returned on its own; give the old instance its Stop
+		// before the new one replaces it.
+		if err := s.stopActive(
+			ctx, []*serviceRun{run}, ErrRestartRequested,
+		); err != nil {
+			return err
+		}
+	}
+
+	return s.startFresh(ctx, []string{name})
+}
+
+// StopService stops a running service. Every running service that
+// depends on it, directly or not, is stopped first, in reverse
+// dependency order. Dependents stay stopped until started again.
+// Their contexts are cancelled with ErrStopRequested as the cause.
+func (s *ServiceManager) StopService(
+	ctx context.Context,
+	name string,
+) error {
+	s.controlMu.Lock()
+	defer s.controlMu.Unlock()
+
+	run, err := s.liveRun(name)
+	if err != nil {
+		return err
+	}
+
+	if !s.isActive(run) {
+		return ctxerrors.Wrapf(ErrServiceNotRunning, "%s", name)
+	}
+
+	return s.stopActive(
+		ctx, s.activeWithDependents(name), ErrStopRequested,
+	)
+}
+
+// RestartService stops a service and starts a fresh instance in
+// its place; the old one's context is cancelled with
+// ErrRestartRequested as the cause. Its dependents keep running;
+// use RestartServiceWithDependents to restart them as well.
+func (s *ServiceManager) RestartService(
+	ctx context.Context,
+	name string,
+) error {
+	s.controlMu.Lock()
+	defer s.controlMu.Unlock()
+
+	run, err := s.liveRun(name)
+	if err != nil {
+		return err
+	}
+
+	if s.isActive(run) {
+		if err := s.stopActive(
+			ctx, []*serviceRun{run}, ErrRestartRequested,
+		); err != nil {
+			return err
+		}
+	}
+
+	return s.startFresh(ctx, []string{name})
+}
+
+// RestartServiceWithDependents restarts a service together with
+// every running service that depends on it. Dependents are stopped
+// before it and started again once it is ready.
+func (s *ServiceManager) RestartServiceWithDependents(
+	ctx context.Context,
+	name string,
+) error {
+	s.controlMu.Lock()
+	defer s.controlMu.Unlock()
+
+	if _, err := s.liveRun(name); err != nil {
+		return err
+	}
+
+	targets := s.activeWithDependents(name)
+	if err := s.stopActive(ctx, targets, ErrRestartRequested); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(targets)+1)
+	for _, run := range targets {
+		names = append(names, run.name)
+	}
+
+	if !slices.Contains(names, name) {
+		names = append(names, name)
+	}
+
+	return s.startFresh(ctx, names)
+}
+
+// AddService adds a service to the running manager and returns
+// once it is ready. Dependencies it declares that are part of the
+// live graph must be running; others are treated as out of process
+// and skipped, as at startup. Once it has started, the service is
+// also added to the set the next Run starts; one that fails to
+// start is taken back out, so it can be added again.
+func (s *ServiceManager) AddService(
+	ctx context.Context,
+	service Service,
+) error {
+	s.controlMu.Lock()
+	defer s.controlMu.Unlock()
+
+	run, err := s.admit(ctx, service)
+	if err != nil {
+		return err
+	}
+
+	if err := s.startRuns(ctx, []*serviceRun{run}); err != nil {
+		s.withdraw(ctx, run)
+
+		return err
+	}
+
+	s.AddContext(ctx, service)
+
+	return nil
+}
+
+// RegisterAndStart registers factory under name and, using an
+// instance built from it, adds the service to the running manager
+// as AddService does. Later restarts build from the same factory.
+// Nothing stays registered when the service cannot join the graph
+// or fails to start.
+func (s *ServiceManager) RegisterAndStart(
+	ctx context.Context,
+	name string,
+	factory ServiceFactory,
+) error {
+	s.controlMu.Lock()
+	defer s.controlMu.Unlock()
+
+	svc, err := instantiate(name, factory)
+	if err != nil {
+		return err
+	}
+
+	s.emit(Event{Type: EventInstantiated, Service: name})
+
+	run, err := s.admit(ctx, svc)
+	if err != nil {
+		return err
+	}
+
+	restore := s.swapFactory(name, factory)
+
+	if err := s.startRuns(ctx, []*serviceRun{run}); err != nil {
+		s.withdraw(ctx, run)
+		restore()
+
+		return err
+	}
+
+	s.AddContext(ctx, svc)
+
+	return nil
+}
+
+// swapFactory registers factory under name and returns the
+// function that puts back what was registered under it before.
+func (s *ServiceManager) swapFactory(
+	name string,
+	factory ServiceFactory,
+) func() {
+	s.factoriesMu.RLock()
+	previous, registered := s.factories[name]
+	s.factoriesMu.RUnlock()
+
+	s.Register(name, factory)
+
+	return func() {
+		s.factoriesMu.Lock()
+		defer s.factoriesMu.Unlock()
+
+		if registered {
+			s.factories[name] = previous
+		} else {
+			delete(s.factories, name)
+		}
+	}
+}
+
+// RemoveService stops a service, if it is running, and takes it
+// out of the live graph and of the set the next Run starts. A
+// service other services in the graph depend on cannot be removed;
+// remove its dependents first. Registered factories are kept.
+func (s *ServiceManager) RemoveService(
+	ctx context.Context,
+	name string,
+) error {
+	s.controlMu.Lock()
+	defer s.controlMu.Unlock()
+
+	run, err := s.liveRun(name)
+	if err != nil {
+		return err
+	}
+
+	s.runsMu.Lock()
+	dependents := s.dependentsOf(name)
+	active := run.active()
+	s.runsMu.Unlock()
+
+	if len(dependents) > 0 {
+		return ctxerrors.Wrapf(
+			ErrServiceHasDependents,
+			"%s is needed by %s", name, strings.Join(dependents, ", "),
+		)
+	}
+
+	if active {
+		if err := s.stopActive(
+			ctx, []*serviceRun{run}, ErrStopRequested,
+		); err != nil {
+			return err
+		}
+	}
+
+	s.runsMu.Lock()
+	delete(s.runs, name)
+	s.completeIfFinished()
+	s.runsMu.Unlock()
+
+	s.servicesMutex.Lock()
+	delete(s.services, name)
+	s.servicesMutex.Unlock()
+
+	s.status.remove(name)
+
+	ctxscope.GetLogger(withServiceScope(ctx, name)).Info("removed service")
+
+	return nil
+}
+
+// admit validates service against the live graph and gives it a
+// status entry. The returned run is not part of the live graph yet;
+// startRuns puts it there, and withdraw takes it back out.
+func (s *ServiceManager) admit(
+	ctx context.Context,
+	service Service,
+) (*serviceRun, error) {
+	name := service.Name()
+
+	deps, err := s.liveDependencies(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+
+	run := newServiceRun(name, service, deps)
+
+	s.runsMu.Lock()
+	err = s.missingDependency([]*serviceRun{run})
+	s.runsMu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.status.add(name, deps, isAllowedFailure(service))
+
+	return run, nil
+}
+
+// withdraw undoes admit for a run that failed to start: the run is
+// stopped if it was launched and dropped from the live graph and the
+// status board, so its name can be added again. Stopping it is not
+// cut short by ctx, which has often ended already, but is bounded by
+// the stop timeout.
+func (s *ServiceManager) withdraw(ctx context.Context, run *serviceRun) {
+	s.runsMu.Lock()
+
+	active := run.active()
+
+	if s.runs[run.name] == run {
+		delete(s.runs, run.name)
+		s.completeIfFinished()
+	}
+
+	s.runsMu.Unlock()
+
+	if active {
+		stopCtx, cancel := context.WithTimeout(
+			context.WithoutCancel(ctx), s.stopTimeout,
+		)
+		defer cancel()
+
+		err := s.stopActive(stopCtx, []*serviceRun{run}, ErrStopRequested)
+		if err != nil {
+			ctxscope.GetLogger(withServiceScope(ctx, run.name)).Warn(
+				"failed to stop service that did not start",
+				"err", err,
+			)
+		}
+	}
+
+	s.status.remove(run.name)
+}
+
+// liveDependencies resolves the dependencies service declares
+// against the live graph. It rejects a name already in the graph
+// and a declared dependency that leads back to service.
+func (s *ServiceManager) liveDependencies(
+	ctx context.Context,
+	service Service,
+) ([]string, error) {
+	name := service.Name()
+
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+
+	if s.runs == nil || s.stopping {
+		return nil, ErrManagerNotRunning
+	}
+
+	if _, exists := s.runs[name]; exists {
+		return nil, ctxerrors.Wrapf(ErrServiceExists, "%s", name)
+	}
+
+	dep, ok := service.(Dependent)
+	if !ok {
+		return nil, nil
+	}
+
+	var deps []string
+
+	for _, depName := range dep.Dependencies() {
+		if depName == name || s.declaresDependency(depName, name) {
+			return nil, ctxerrors.Wrapf(
+				ErrCyclicDependency, "%s and %s", name, depName,
+			)
+		}
+
+		depNames := instanceNames(s.runs, depName)
+		if len(depNames) == 0 {
+			ctxscope.GetLogger(withServiceScope(ctx, name)).Warn(
+				"dependency not in process, skipping",
+				"dependency", depName,
+			)
+
+			continue
+		}
+
+		deps = append(deps, depNames...)
+	}
+
+	return deps, nil
+}
+
+// declaresDependency reports whether from, or anything it declares
+// a dependency on within the live graph, declares target. Declared
+// rather than resolved dependencies are followed because a name
+// that was out of process at startup can join the graph later.
+// Callers hold runsMu.
+func (s *ServiceManager) declaresDependency(from, target string) bool {
+	seen := map[string]bool{}
+	queue := []string{from}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		if seen[current] {
+			continue
+		}
+
+		seen[current] = true
+
+		run, ok := s.runs[current]
+		if !ok {
+			queue = append(queue, instanceNames(s.runs, current)...)
+
+			continue
+		}
+
+		dep, ok := run.service.(Dependent)
+		if !ok {
+			continue
+		}
+
+		for _, name := range dep.Dependencies() {
+			if name == target {
+				return true
+			}
+
+			queue = append(queue, name)
+		}
+	}
+
+	return false
+}
+
+// liveRun returns the current run of name while the manager is
+// running.
+func (s *ServiceManager) liveRun(name string) (*serviceRun, error) {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+
+	if s.runs == nil || s.stopping {
+		return nil, ErrManagerNotRunning
+	}
+
+	run, ok := s.runs[name]
+	if !ok {
+		return nil, ctxerrors.Wrapf(ErrServiceNotFound, "%s", name)
+	}
+
+	return run, nil
+}
+
+func (s *ServiceManager) isActive(run *serviceRun) bool {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+
+	return run.active()
+}
+
+func (s *ServiceManager) isStopped(run *serviceRun) bool {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+
+	return run.stopped
+}
+
+// activeWithDependents returns the active run of name plus every
+// active run that depends on it, directly or transitively.
+func (s *ServiceManager) activeWithDependents(name string) []*serviceRun {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+
+	var targets []*serviceRun
+
+	seen := map[string]bool{}
+	queue := []string{name}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		if seen[current] {
+			continue
+		}
+
+		seen[current] = true
+
+		run, ok := s.runs[current]
+		if !ok {
+			continue
+		}
+
+		if run.active() {
+			targets = append(targets, run)
+		}
+
+		queue = append(queue, s.dependentsOf(current)...)
+	}
+
+	return targets
+}
+
+// stopActive cancels each run with cause, stops them in reverse
+// dependency order and waits for their goroutines to return.
+func (s *ServiceManager) stopActive(
+	ctx context.Context,
+	runs []*serviceRun,
+	cause error,
+) error {
+	s.runsMu.Lock()
+
+	for _, run := range runs {
+		run.stopped = true
+		run.cancel(cause)
+	}
+
+	s.runsMu.Unlock()
+
+	// A failed Stop is logged and emitted; the run is over either
+	// way, so it does not hold back what the caller does next.
+	_ = s.stopRuns(ctx, runs)
+
+	for _, run := range runs {
+		select {
+		case <-run.exited:
+		case <-ctx.Done():
+			return ctxerrors.Wrapf(
+				ctx.Err(), "wait for service %s to exit", run.name,
+			)
+		}
+	}
+
+	return nil
+}
+
+// startFresh replaces the runs of names with fresh instances and
+// starts them.
+func (s *ServiceManager) startFresh(
+	ctx context.Context,
+	names []string,
+) error {
+	if err := s.checkDependencies(names); err != nil {
+		return err
+	}
+
+	fresh, err := s.freshRuns(names)
+	if err != nil {
+		return err
+	}
+
+	for _, run := range fresh {
+		run.resumed = resumption{reason: RestartReasonControl}
+		s.status.restarted(run.name)
+	}
+
+	return s.startRuns(ctx, fresh)
+}
+
+// freshRuns builds a run with a fresh instance for each of names,
+// keeping the dependencies of its current run.
+func (s *ServiceManager) freshRuns(names []string) ([]*serviceRun, error) {
+	fresh := make([]*serviceRun, 0, len(names))
+
+	for _, name := range names {
+		current, err := s.liveRun(name)
+		if err != nil {
+			return nil, err
+		}
+
+		svc, err := s.freshInstance(name, current.service)
+		if err != nil {
+			return nil, err
+		}
+
+		fresh = append(fresh, newServiceRun(name, svc, current.deps))
+	}
+
+	return fresh, nil
+}
+
+// startRuns puts runs into the live graph and launches each once
+// its dependencies are ready. It returns when all of them are
+// ready or one of them failed to get there.
+func (s *ServiceManager) startRuns(
+	ctx context.Context,
+	fresh []*serviceRun,
+) error {
+	runCtx, err := s.replaceRuns(fresh)
+	if err != nil {
+		return err
+	}
+
+	results := make(chan error, len(fresh))
+
+	for _, run := range fresh {
+		go func() {
+			defer s.wg.Done()
+
+			ctxscope.GetLogger(
+				withServiceScope(ctx, run.name),
+			).Info("starting service on request")
+
+			results <- s.startWhenDepsReady(runCtx, run, false)
+		}()
+	}
+
+	errs := make([]error, 0, len(fresh))
+
+	for range fresh {
+		select {
+		case err := <-results:
+			errs = append(errs, err)
+		case <-ctx.Done():
+			return ctxerrors.Wrap(ctx.Err(), "wait for services to start")
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// freshInstance builds a new instance from the factory name was
+// built by. Services added directly have no factory, so current is
+// reused.
+//
+//nolint:ireturn
+func (s *ServiceManager) freshInstance(
+	name string,
+	current Service,
+) (Service, error) {
+	s.factoriesMu.RLock()
+	factory, ok := s.factoryFor(name)
+	s.factoriesMu.RUnlock()
+
+	if !ok {
+		return current, nil
+	}
+
+	svc, err := instantiate(name, factory)
+	if err != nil {
+		return nil, err
+	}
+
+	s.emit(Event{Type: EventInstantiated, Service: name})
+
+	return svc, nil
+}
+
+// checkDependencies fails early, before any factory is called,
+// when names need a service that is not running.
+func (s *ServiceManager) checkDependencies(names []string) error {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+
+	runs := make([]*serviceRun, 0, len(names))
+	for _, name := range names {
+		runs = append(runs, s.runs[name])
+	}
+
+	return s.missingDependency(runs)
+}
+
+// missingDependency reports the first dependency of runs that is
+// neither running nor starting with them: ErrDependencyNotFound
+// when it has left the live graph, ErrDependencyNotRunning when it
+// is only stopped. Callers hold runsMu.
+func (s *ServiceManager) missingDependency(runs []*serviceRun) error {
+	starting := make(map[string]bool, len(runs))
+	for _, run := range runs {
+		starting[run.name] = true
+	}
+
+	for _, run := range runs {
+		for _, dep := range run.deps {
+			if starting[dep] {
+				continue
+			}
+
+			current, ok := s.runs[dep]
+			if !ok {
+				return ctxerrors.Wrapf(
+					ErrDependencyNotFound, "%s needs %s", run.name, dep,
+				)
+			}
+
+			if current.active() {
+				continue
+			}
+
+			return ctxerrors.Wrapf(
+				ErrDependencyNotRunning, "%s needs %s", run.name, dep,
+			)
+		}
+	}
+
+	return nil
+}
+
+// replaceRuns swaps the fresh runs into the live graph once every
+// dependency outside the set is running. The goroutines that will
+// launch them are added to the wait group here, under the same
+// lock Stop takes, so Run cannot finish waiting before they exist.
+func (s *ServiceManager) replaceRuns(
+	fresh []*serviceRun,
+) (context.Context, error) {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+
+	if s.stopping {
+		return nil, ErrManagerNotRunning
+	}
+
+	if err := s.missingDependency(fresh); err != nil {
+		return nil, err
+	}
+
+	for _, run := range fresh {
+		s.runs[run.name] = run
+	}
+
+	close(s.runsChanged)
+	s.runsChanged = make(chan struct{})
+
+	s.wg.Add(len(fresh))
+
+	return s.runCtx, nil
+}
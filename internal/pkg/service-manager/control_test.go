@@ -0,0 +1,297 @@
+package servicemanager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceManager_ControlRequiresRunningManager(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+	newServiceFixture(sm)
+
+	ctx := t.Context()
+
+	require.ErrorIs(t, sm.StartService(ctx, "db"), ErrManagerNotRunning)
+	require.ErrorIs(t, sm.StopService(ctx, "db"), ErrManagerNotRunning)
+	require.ErrorIs(t, sm.RestartService(ctx, "db"), ErrManagerNotRunning)
+	require.ErrorIs(
+		t, sm.RestartServiceWithDependents(ctx, "db"), ErrManagerNotRunning,
+	)
+
+	stop := runControlled(t, sm, 2)
+	stop()
+
+	require.ErrorIs(t, sm.StartService(ctx, "db"), ErrManagerNotRunning)
+}
+
+func TestServiceManager_RestartService(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+	f := newServiceFixture(sm)
+
+	stop := runControlled(t, sm, 2)
+	defer stop()
+
+	require.NoError(t, sm.RestartService(t.Context(), "db"))
+
+	built, stopOrder := f.snapshot()
+	assert.Equal(t, map[string]int{"db": 2, "api": 1}, built)
+	assert.Equal(t, []string{"db"}, stopOrder)
+
+	require.ErrorIs(
+		t, sm.RestartService(t.Context(), "cache"), ErrServiceNotFound,
+	)
+}
+
+func TestServiceManager_StopAndStartService(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+	f := newServiceFixture(sm)
+
+	stop := runControlled(t, sm, 2)
+	defer stop()
+
+	ctx := t.Context()
+
+	require.NoError(t, sm.StopService(ctx, "db"))
+
+	_, stopOrder := f.snapshot()
+	assert.Equal(t, []string{"api", "db"}, stopOrder)
+
+	require.ErrorIs(t, sm.StopService(ctx, "db"), ErrServiceNotRunning)
+	require.ErrorIs(t, sm.StartService(ctx, "api"), ErrDependencyNotRunning)
+
+	require.NoError(t, sm.StartService(ctx, "db"))
+	require.ErrorIs(t, sm.StartService(ctx, "db"), ErrServiceRunning)
+	require.NoError(t, sm.StartService(ctx, "api"))
+
+	built, _ := f.snapshot()
+	assert.Equal(t, map[string]int{"db": 2, "api": 2}, built)
+}
+
+func TestServiceManager_MissingDependency(t *testing.T) {
+	testCases := []struct {
+		name string
+		dep  string
+		want error
+	}{
+		{"stopped", "db", ErrDependencyNotRunning},
+		{"left the graph", "cache", ErrDependencyNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ResetInstance()
+
+			sm := GetInstance()
+			sm.runs = map[string]*serviceRun{
+				"db": newServiceRun("db", NewTestService("db"), nil),
+			}
+
+			api := newServiceRun(
+				"api", NewTestService("api"), []string{tc.dep},
+			)
+
+			sm.runsMu.Lock()
+			err := sm.missingDependency([]*serviceRun{api})
+			sm.runsMu.Unlock()
+
+			require.ErrorIs(t, err, tc.want)
+			assert.Contains(t, err.Error(), "api needs "+tc.dep)
+		})
+	}
+}
+
+func TestServiceManager_RestartServiceWithDependents(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+	f := newServiceFixture(sm)
+
+	stop := runControlled(t, sm, 2)
+	defer stop()
+
+	require.NoError(t, sm.RestartServiceWithDependents(t.Context(), "db"))
+
+	built, stopOrder := f.snapshot()
+	assert.Equal(t, map[string]int{"db": 2, "api": 2}, built)
+	assert.Equal(t, []string{"api", "db"}, stopOrder)
+}
+
+func TestServiceManager_AddService(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+	newServiceFixture(sm)
+
+	stop := runControlled(t, sm, 2)
+	defer stop()
+
+	ctx := t.Context()
+
+	worker := NewDependentMockService("worker", "db", "elsewhere")
+	require.NoError(t, sm.AddService(ctx, worker))
+	waitForRunCalled(t, []Service{worker})
+
+	tests := []struct {
+		name    string
+		service Service
+		wantErr error
+	}{
+		{
+			name:    "name already in graph",
+			service: NewMockService("worker"),
+			wantErr: ErrServiceExists,
+		},
+		{
+			name:    "depends on itself",
+			service: NewDependentMockService("loop", "loop"),
+			wantErr: ErrCyclicDependency,
+		},
+		{
+			name:    "graph already declares it",
+			service: NewDependentMockService("elsewhere", "worker"),
+			wantErr: ErrCyclicDependency,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.ErrorIs(t, sm.AddService(ctx, tt.service), tt.wantErr)
+		})
+	}
+
+	require.NoError(t, sm.StopService(ctx, "db"))
+	require.ErrorIs(
+		t,
+		sm.AddService(ctx, NewDependentMockService("cron", "db")),
+		ErrDependencyNotRunning,
+	)
+}
+
+func TestServiceManager_RegisterAndStart(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+	f := newServiceFixture(sm)
+
+	stop := runControlled(t, sm, 2)
+	defer stop()
+
+	ctx := t.Context()
+
+	factory := func() (Service, error) {
+		f.recordBuild("plugin")
+
+		return NewTestService("plugin"), nil
+	}
+
+	require.NoError(t, sm.RegisterAndStart(ctx, "plugin", factory))
+	require.NoError(t, sm.RestartService(ctx, "plugin"))
+
+	built, _ := f.snapshot()
+	assert.Equal(t, 2, built["plugin"])
+	assert.Contains(t, sm.RegisteredNames(), "plugin")
+}
+
+func TestServiceManager_FailedAddRollsBack(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+	newServiceFixture(sm)
+
+	stop := runControlled(t, sm, 2)
+	defer stop()
+
+	ctx := t.Context()
+
+	// Neither instance becomes ready before the caller gives up.
+	addCtx, cancelAdd := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancelAdd()
+
+	stuck := NewReadyMockService("plugin")
+	require.ErrorIs(
+		t, sm.AddService(addCtx, stuck), context.DeadlineExceeded,
+	)
+	assert.True(t, stuck.WasStopCalled())
+
+	registerCtx, cancelRegister := context.WithTimeout(
+		ctx, 20*time.Millisecond,
+	)
+	defer cancelRegister()
+
+	require.ErrorIs(t, sm.RegisterAndStart(
+		registerCtx, "plugin",
+		func() (Service, error) { return NewReadyMockService("plugin"), nil },
+	), context.DeadlineExceeded)
+	assert.NotContains(t, sm.RegisteredNames(), "plugin")
+	assert.NotContains(t, statusNames(sm), "plugin")
+
+	sm.servicesMutex.RLock()
+	assert.NotContains(t, sm.services, "plugin")
+	sm.servicesMutex.RUnlock()
+
+	// The name is free again.
+	require.NoError(t, sm.AddService(ctx, NewMockService("plugin")))
+	waitForState(t, sm, "plugin", StateRunning)
+}
+
+func TestServiceManager_RemoveService(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+	f := newServiceFixture(sm)
+
+	stop := runControlled(t, sm, 2)
+	defer stop()
+
+	ctx := t.Context()
+
+	require.ErrorIs(t, sm.RemoveService(ctx, "db"), ErrServiceHasDependents)
+	require.NoError(t, sm.RemoveService(ctx, "api"))
+	require.NoError(t, sm.RemoveService(ctx, "db"))
+	require.ErrorIs(t, sm.RemoveService(ctx, "db"), ErrServiceNotFound)
+
+	_, stopOrder := f.snapshot()
+	assert.Equal(t, []string{"api", "db"}, stopOrder)
+
+	sm.servicesMutex.RLock()
+	assert.Empty(t, sm.services)
+	sm.servicesMutex.RUnlock()
+}
+
+// TestServiceManager_EditServicesWhileRunning guards against Run
+// holding the services lock for its lifetime, which made Add and
+// ClearServices block until shutdown.
+func TestServiceManager_EditServicesWhileRunning(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+	newServiceFixture(sm)
+
+	stop := runControlled(t, sm, 2)
+	defer stop()
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		sm.Add(NewTestService("later"))
+		sm.ClearServices()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(runHangGuard):
+		t.Fatal("Add and ClearServices blocked while Run was active")
+	}
+}
@@ -0,0 +1,238 @@
+package servicemanager
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/psyb0t/ctxerrors"
+)
+
+// cronHorizon is how far ahead next looks for a matching minute
+// before it gives up on an expression that never fires.
+const cronHorizon = 5 * 366 * 24 * time.Hour
+
+const cronFieldCount = 5
+
+// cronField is the range and the names one field of a cron
+// expression accepts.
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names []string
+}
+
+// cronFields are minute, hour, day of month, month and day of week.
+// Day of week accepts 7 as Sunday too.
+//
+//nolint:gochecknoglobals
+var cronFields = [cronFieldCount]cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{
+		"jan", "feb", "mar", "apr", "may", "jun",
+		"jul", "aug", "sep", "oct", "nov", "dec",
+	}},
+	{name: "day of week", min: 0, max: 7, names: []string{
+		"sun", "mon", "tue", "wed", "thu", "fri", "sat",
+	}},
+}
+
+// cronDescriptors are the shorthands a cron expression may use.
+//
+//nolint:gochecknoglobals
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronSpec is a parsed cron expression: one bitset of matching
+// values per field, read in loc. As in cron(8), a day matches
+// either day field when both are restricted, and both otherwise.
+type cronSpec struct {
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	anyDay bool
+	loc    *time.Location
+}
+
+// parseCron parses a five-field cron expression, or one of the
+// @ descriptors, to be read in loc.
+func parseCron(expr string, loc *time.Location) (*cronSpec, error) {
+	fields := strings.Fields(expr)
+	if len(fields) == 1 {
+		if spec, ok := cronDescriptors[strings.ToLower(fields[0])]; ok {
+			fields = strings.Fields(spec)
+		}
+	}
+
+	if len(fields) != cronFieldCount {
+		return nil, ctxerrors.Wrapf(
+			ErrInvalidSchedule,
+			"cron %q: want %d fields, got %d",
+			expr, cronFieldCount, len(fields),
+		)
+	}
+
+	var sets [cronFieldCount]uint64
+
+	for i, field := range fields {
+		set, err := cronFields[i].parse(field)
+		if err != nil {
+			return nil, ctxerrors.Wrapf(err, "cron %q", expr)
+		}
+
+		sets[i] = set
+	}
+
+	const sunday = 7
+
+	if sets[4]&(1<<sunday) != 0 {
+		sets[4] = sets[4]&^(1<<sunday) | 1
+	}
+
+	return &cronSpec{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		anyDay: strings.HasPrefix(fields[2], "*") ||
+			strings.HasPrefix(fields[4], "*"),
+		loc: loc,
+	}, nil
+}
+
+// parse turns one field, a comma separated list of values, ranges
+// and steps, into the set of values it matches.
+func (f cronField) parse(field string) (uint64, error) {
+	var set uint64
+
+	for part := range strings.SplitSeq(field, ",") {
+		span, stepText, stepped := strings.Cut(part, "/")
+
+		step := 1
+
+		if stepped {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n < 1 {
+				return 0, ctxerrors.Wrapf(
+					ErrInvalidSchedule, "%s: bad step %q", f.name, stepText,
+				)
+			}
+
+			step = n
+		}
+
+		lo, hi, err := f.span(span, stepped)
+		if err != nil {
+			return 0, err
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+
+	return set, nil
+}
+
+// span returns the bounds of a range: * is the whole field, and a
+// single value with a step runs to the end of it.
+func (f cronField) span(span string, stepped bool) (int, int, error) {
+	if span == "*" {
+		return f.min, f.max, nil
+	}
+
+	loText, hiText, ranged := strings.Cut(span, "-")
+
+	lo, err := f.value(loText)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	hi := lo
+
+	switch {
+	case ranged:
+		if hi, err = f.value(hiText); err != nil {
+			return 0, 0, err
+		}
+	case stepped:
+		hi = f.max
+	}
+
+	if lo > hi {
+		return 0, 0, ctxerrors.Wrapf(
+			ErrInvalidSchedule, "%s: empty range %q", f.name, span,
+		)
+	}
+
+	return lo, hi, nil
+}
+
+func (f cronField) value(text string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(text, name) {
+			return i + f.min, nil
+		}
+	}
+
+	v, err := strconv.Atoi(text)
+	if err != nil || v < f.min || v > f.max {
+		return 0, ctxerrors.Wrapf(
+			ErrInvalidSchedule, "%s: bad value %q", f.name, text,
+		)
+	}
+
+	return v, nil
+}
+
+// next returns the first matching minute after after, or the zero
+// time when none comes within cronHorizon.
+func (c *cronSpec) next(after time.Time) time.Time {
+	t := after.In(c.loc).Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(cronHorizon)
+
+	for t.Before(limit) {
+		switch {
+		case !hasBit(c.month, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, c.loc)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.loc)
+		case !hasBit(c.hour, t.Hour()):
+			t = t.Add(time.Hour - time.Duration(t.Minute())*time.Minute)
+		case !hasBit(c.minute, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+func (c *cronSpec) dayMatches(t time.Time) bool {
+	dom := hasBit(c.dom, t.Day())
+	dow := hasBit(c.dow, int(t.Weekday()))
+
+	if c.anyDay {
+		return dom && dow
+	}
+
+	return dom || dow
+}
+
+func hasBit(set uint64, v int) bool {
+	return set&(1<<v) != 0
+}
@@ -0,0 +1,122 @@
+package servicemanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCron_Next(t *testing.T) {
+	plusTwo := time.FixedZone("UTC+2", 2*60*60)
+
+	// A Friday.
+	from := time.Date(2026, time.March, 13, 10, 7, 30, 0, time.UTC)
+
+	testCases := []struct {
+		name string
+		expr string
+		loc  *time.Location
+		want time.Time
+	}{
+		{
+			name: "every minute",
+			expr: "* * * * *",
+			want: time.Date(2026, time.March, 13, 10, 8, 0, 0, time.UTC),
+		},
+		{
+			name: "step",
+			expr: "*/15 * * * *",
+			want: time.Date(2026, time.March, 13, 10, 15, 0, 0, time.UTC),
+		},
+		{
+			name: "list and range",
+			expr: "0 8-9,17 * * *",
+			want: time.Date(2026, time.March, 13, 17, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "weekdays by name",
+			expr: "30 9 * * MON-fri",
+			want: time.Date(2026, time.March, 16, 9, 30, 0, 0, time.UTC),
+		},
+		{
+			name: "sunday as 7",
+			expr: "0 0 * * 7",
+			want: time.Date(2026, time.March, 15, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "either day field",
+			expr: "0 0 1 * sat",
+			want: time.Date(2026, time.March, 14, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "month by name",
+			expr: "0 0 1 jul *",
+			want: time.Date(2026, time.July, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "descriptor",
+			expr: "@daily",
+			want: time.Date(2026, time.March, 14, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "leap day",
+			expr: "0 0 29 2 *",
+			want: time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "location",
+			expr: "0 12 * * *",
+			loc:  plusTwo,
+			want: time.Date(2026, time.March, 14, 12, 0, 0, 0, plusTwo),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			loc := tc.loc
+			if loc == nil {
+				loc = time.UTC
+			}
+
+			spec, err := parseCron(tc.expr, loc)
+			require.NoError(t, err)
+
+			got := spec.next(from)
+			assert.True(t, tc.want.Equal(got), "want %s, got %s", tc.want, got)
+		})
+	}
+}
+
+func TestParseCron_NeverFires(t *testing.T) {
+	spec, err := parseCron("0 0 30 2 *", time.UTC)
+	require.NoError(t, err)
+
+	assert.True(t, spec.next(time.Now()).IsZero())
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	testCases := []struct {
+		name string
+		expr string
+	}{
+		{name: "empty", expr: ""},
+		{name: "too few fields", expr: "* * * *"},
+		{name: "too many fields", expr: "* * * * * *"},
+		{name: "out of range", expr: "60 * * * *"},
+		{name: "below range", expr: "* * 0 * *"},
+		{name: "zero step", expr: "*/0 * * * *"},
+		{name: "bad step", expr: "*/x * * * *"},
+		{name: "empty range", expr: "5-1 * * * *"},
+		{name: "unknown name", expr: "* * * foo *"},
+		{name: "unknown descriptor", expr: "@sometimes"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseCron(tc.expr, time.UTC)
+			require.ErrorIs(t, err, ErrInvalidSchedule)
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package servicemanager
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/psyb0t/ctxscope"
+)
+
+// defaultDrainTimeout leaves the runner, which gives up on shutdown
+// after 10s by default, time to stop the services after draining.
+const defaultDrainTimeout = 5 * time.Second
+
+// drain lets the services finish their in-flight work before Stop
+// cancels them. Health reports them draining at once; after the
+// pre-stop delay, meant for load balancers to notice and deregister
+// the app, Drain of every Drainer among runs is called in reverse
+// dependency order, all within the drain timeout. Both end early
+// once ctx, or the context of any other Stop call, is done. Nothing
+// drains once Run's context has ended: the services are cancelled
+// already.
+func (s *ServiceManager) drain(ctx context.Context, runs []*serviceRun) {
+	s.runsMu.Lock()
+	live := s.runCtx != nil && s.runCtx.Err() == nil
+	s.runsMu.Unlock()
+
+	if !live || len(runs) == 0 {
+		return
+	}
+
+	for _, run := range runs {
+		s.status.drain(run.name)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer context.AfterFunc(s.stopExpired, cancel)()
+
+	if s.preStopDelay > 0 {
+		ctxscope.GetLogger(ctx).Info("waiting before draining services",
+			"delay", s.preStopDelay,
+		)
+
+		timer := time.NewTimer(s.preStopDelay)
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+
+			return
+		}
+	}
+
+	ctx, cancelDrain := context.WithTimeout(ctx, s.drainTimeout)
+	defer cancelDrain()
+
+	s.drainRuns(ctx, runs)
+}
+
+// drainRuns calls Drain of each Drainer among runs only after every
+// run that depends on it has drained, and returns once all have or
+// ctx is done. Services with no path between them drain
+// concurrently.
+func (s *ServiceManager) drainRuns(ctx context.Context, runs []*serviceRun) {
+	drained := make(map[string]chan struct{}, len(runs))
+	dependents := make(map[string][]string, len(runs))
+
+	s.runsMu.Lock()
+
+	for _, run := range runs {
+		drained[run.name] = make(chan struct{})
+		dependents[run.name] = s.dependentsOf(run.name)
+	}
+
+	s.runsMu.Unlock()
+
+	var wg sync.WaitGroup
+
+	for _, run := range runs {
+		wg.Go(func() {
+			defer close(drained[run.name])
+
+			for _, dependent := range dependents[run.name] {
+				ch, ok := drained[dependent]
+				if !ok {
+					continue
+				}
+
+				select {
+				case <-ch:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			if drainer, ok := run.service.(Drainer); ok {
+				s.drainService(
+					withServiceScope(ctx, run.name), run.name, drainer,
+				)
+			}
+		})
+	}
+
+	wg.Wait()
+}
+
+// drainService calls Drain of drainer, the instance running as
+// name, and gives up on it once ctx is done. A failed or abandoned
+// Drain is only logged: the service is stopped either way.
+func (s *ServiceManager) drainService(
+	ctx context.Context,
+	name string,
+	drainer Drainer,
+) {
+	done := make(chan error, 1)
+
+	s.emit(Event{Type: EventDrainStarted, Service: name})
+	ctxscope.GetLogger(ctx).Debug("draining service")
+
+	go func() {
+		err := drainer.Drain(ctx)
+		if err != nil {
+			ctxscope.GetLogger(ctx).Warn("failed to drain service",
+				"err", err,
+			)
+		}
+
+		s.emit(Event{Type: EventDrainFinished, Service: name, Err: err})
+
+		done <- err
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		ctxscope.GetLogger(ctx).Warn("service drain timed out",
+			"timeout", s.drainTimeout,
+		)
+		s.emit(Event{
+			Type:    EventDrainTimedOut,
+			Service: name,
+			Timeout: s.drainTimeout,
+			Err:     ErrDrainTimeout,
+		})
+	}
+}
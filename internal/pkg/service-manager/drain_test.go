@@ -0,0 +1,275 @@
+package servicemanager
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// drainingService is a lossRecordingService whose Drain does what
+// drain does.
+type drainingService struct {
+	*lossRecordingService
+	drain func(ctx context.Context) error
+}
+
+func (d *drainingService) Drain(ctx context.Context) error {
+	return d.drain(ctx)
+}
+
+// handOffService stops serving, failing Run, once it is drained,
+// and lingers in Drain as long as a restart would take. It would be
+// retried for that if it were not shutting down.
+type handOffService struct {
+	Service
+	drained  chan struct{}
+	returned chan struct{}
+	runs     atomic.Int32
+}
+
+func (h *handOffService) Run(ctx context.Context) error {
+	if h.runs.Add(1) == 1 {
+		defer close(h.returned)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-h.drained:
+		return errTestService
+	}
+}
+
+func (h *handOffService) Drain(context.Context) error {
+	close(h.drained)
+	<-h.returned
+	time.Sleep(noRunReturn)
+
+	return nil
+}
+
+func (h *handOffService) MaxRetries() int { return UnlimitedRetries }
+
+func (h *handOffService) RetryDelay() time.Duration { return 0 }
+
+func TestServiceManager_DrainBeforeCancel(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	var (
+		mu      sync.Mutex
+		drained []string
+	)
+
+	newDrainer := func(name string, deps ...string) *drainingService {
+		d := &drainingService{
+			lossRecordingService: newLossRecordingService(name, "", deps...),
+		}
+		d.drain = func(context.Context) error {
+			assert.NoError(t, d.firstCause(), "%s cancelled before Drain", name)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			drained = append(drained, name)
+
+			return nil
+		}
+
+		return d
+	}
+
+	db := newDrainer("db")
+	sm.Add(db, newDrainer("cache", "db"), newDrainer("api", "cache"))
+
+	errSignal := errors.New("terminated")
+	ctx, cancel := context.WithCancelCause(t.Context())
+	runDone := make(chan error, 1)
+
+	go func() {
+		runDone <- sm.Run(ctx)
+	}()
+
+	waitForStartedServices(t, sm, 3)
+	cancel(errSignal)
+
+	require.NoError(t, waitForRun(t, runDone))
+	assert.Equal(t, []string{"api", "cache", "db"}, drained)
+	// The cause Run's context ended with reaches the services.
+	require.ErrorIs(t, waitForCause(t, db.lossRecordingService), errSignal)
+}
+
+func TestServiceManager_PreStopDelay(t *testing.T) {
+	t.Setenv("SERVICEMANAGER_PRESTOPDELAY", "1h")
+
+	ResetInstance()
+
+	sm := GetInstance()
+
+	var drains atomic.Int32
+
+	api := &drainingService{
+		lossRecordingService: newLossRecordingService("api", ""),
+		drain: func(context.Context) error {
+			drains.Add(1)
+
+			return nil
+		},
+	}
+	sm.Add(api)
+
+	stop := runControlled(t, sm, 1)
+	defer stop()
+
+	stopCtx, cancelStop := context.WithCancel(t.Context())
+	stopDone := make(chan error, 1)
+
+	go func() {
+		stopDone <- sm.Stop(stopCtx)
+	}()
+
+	// Load balancers see the app go unhealthy while it still runs.
+	status := waitForState(t, sm, "api", StateDraining)
+	assert.Equal(t, HealthUnhealthy, status.Health.State)
+	waitForHealth(t, sm, HealthUnhealthy)
+
+	time.Sleep(noRunReturn)
+	require.NoError(t, api.firstCause(), "api cancelled during the delay")
+
+	// A Stop deadline cuts the delay short, and leaves no time to
+	// drain.
+	cancelStop()
+
+	select {
+	case err := <-stopDone:
+		require.NoError(t, err)
+	case <-time.After(runHangGuard):
+		t.Fatal("Stop did not return after its context ended")
+	}
+
+	require.ErrorIs(t, waitForCause(t, api.lossRecordingService), ErrShutdown)
+	assert.Zero(t, drains.Load())
+	waitForState(t, sm, "api", StateStopped)
+}
+
+func TestServiceManager_DrainTimeout(t *testing.T) {
+	t.Setenv("SERVICEMANAGER_DRAINTIMEOUT", "20ms")
+
+	ResetInstance()
+
+	sm := GetInstance()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	api := &drainingService{
+		lossRecordingService: newLossRecordingService("api", ""),
+		drain: func(context.Context) error {
+			<-release
+
+			return nil
+		},
+	}
+	sm.Add(api)
+
+	events, unsubscribe := sm.Subscribe(64)
+	defer unsubscribe()
+
+	stop := runControlled(t, sm, 1)
+	defer stop()
+
+	require.NoError(t, sm.Stop(t.Context()))
+
+	event := waitForEvents(t, events, EventDrainTimedOut, 1)[0]
+	assert.Equal(t, "api", event.Service)
+	assert.Equal(t, 20*time.Millisecond, event.Timeout)
+	require.ErrorIs(t, event.Err, ErrDrainTimeout)
+	require.ErrorIs(t, waitForCause(t, api.lossRecordingService), ErrShutdown)
+}
+
+func TestServiceManager_DrainCutByStopDeadline(t *testing.T) {
+	t.Setenv("SERVICEMANAGER_DRAINTIMEOUT", "1h")
+
+	ResetInstance()
+
+	sm := GetInstance()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	api := &drainingService{
+		lossRecordingService: newLossRecordingService("api", ""),
+		drain: func(context.Context) error {
+			<-release
+
+			return nil
+		},
+	}
+	sm.Add(api)
+
+	events, unsubscribe := sm.Subscribe(64)
+	defer unsubscribe()
+
+	stop := runControlled(t, sm, 1)
+	defer stop()
+
+	// Run stops without a deadline, as it does once its context
+	// ends; the runner stops it with one at the same time.
+	go func() {
+		_ = sm.Stop(context.WithoutCancel(t.Context()))
+	}()
+
+	waitForEvents(t, events, EventDrainStarted, 1)
+
+	stopCtx, cancelStop := context.WithTimeout(
+		t.Context(), 20*time.Millisecond,
+	)
+	defer cancelStop()
+
+	stopDone := make(chan error, 1)
+
+	go func() {
+		stopDone <- sm.Stop(stopCtx)
+	}()
+
+	select {
+	case err := <-stopDone:
+		require.NoError(t, err)
+	case <-time.After(runHangGuard):
+		t.Fatal("the Stop deadline did not cut the drain short")
+	}
+
+	waitForEvents(t, events, EventDrainTimedOut, 1)
+	require.ErrorIs(t, waitForCause(t, api.lossRecordingService), ErrShutdown)
+}
+
+func TestServiceManager_ReturnWhileDraining(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	svc := &handOffService{
+		Service:  NewTestService("api"),
+		drained:  make(chan struct{}),
+		returned: make(chan struct{}),
+	}
+	sm.Add(svc)
+
+	stop := runControlled(t, sm, 1)
+	defer stop()
+
+	require.Eventually(t, func() bool {
+		return svc.runs.Load() == 1
+	}, runHangGuard, startedPollInterval)
+
+	require.NoError(t, sm.Stop(t.Context()))
+	assert.Equal(t, int32(1), svc.runs.Load())
+	waitForState(t, sm, "api", StateStopped)
+}
@@ -1,14 +1,280 @@
 package servicemanager
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
 
 var (
-	ErrServiceNotFound    = errors.New("service not found")
-	ErrNoEnabledServices  = errors.New("no enabled services")
-	ErrCyclicDependency   = errors.New("cyclic dependency detected")
-	ErrDependencyNotFound = errors.New("dependency not found")
-	ErrMaxRetriesReached  = errors.New("max retries reached")
-	ErrStopTimeout        = errors.New("service stop timed out")
-	ErrServicePanic       = errors.New("service panicked")
-	ErrNoCommands         = errors.New("service has no commands")
+	ErrServiceNotFound      = errors.New("service not found")
+	ErrNoEnabledServices    = errors.New("no enabled services")
+	ErrCyclicDependency     = errors.New("cyclic dependency detected")
+	ErrDependencyNotFound   = errors.New("dependency not found")
+	ErrMaxRetriesReached    = errors.New("max retries reached")
+	ErrStopTimeout          = errors.New("service stop timed out")
+	ErrServicePanic         = errors.New("service panicked")
+	ErrNoCommands           = errors.New("service has no commands")
+	ErrReadyTimeout         = errors.New("service readiness timed out")
+	ErrExitedBeforeReady    = errors.New("service exited before becoming ready")
+	ErrManagerNotRunning    = errors.New("service manager not running")
+	ErrServiceRunning       = errors.New("service already running")
+	ErrServiceNotRunning    = errors.New("service not running")
+	ErrDependencyNotRunning = errors.New("dependency not running")
+	ErrServiceExists        = errors.New("service already exists")
+	ErrServiceHasDependents = errors.New("service has dependents")
+	ErrRestartIntensity     = errors.New("restart intensity exceeded")
+	ErrUnknownStrategy      = errors.New("unknown supervision strategy")
+	ErrDependencyLost       = errors.New("dependency lost")
+	ErrInvalidConfig        = errors.New("invalid configuration")
+	ErrUnknownPanicPolicy   = errors.New("unknown panic policy")
+	ErrShutdown             = errors.New("service manager shutting down")
+	ErrSiblingFailed        = errors.New("another service failed")
+	ErrRestartedWithSibling = errors.New("restarted with another service")
+	ErrStopRequested        = errors.New("service stop requested")
+	ErrRestartRequested     = errors.New("service restart requested")
+	ErrJobTimeout           = errors.New("jobs did not finish in time")
+	ErrInvalidSchedule      = errors.New("invalid schedule")
+	ErrSuperseded           = errors.New("superseded by the next scheduled run")
+	ErrDrainTimeout         = errors.New("service drain timed out")
+)
+
+// Phase is the part of a service's lifecycle a ServiceError comes
+// from.
+type Phase string
+
+const (
+	// PhaseInstantiate is the service's factory call.
+	PhaseInstantiate Phase = "instantiate"
+	// PhaseRun is every Run attempt, retries included, and the waits
+	// for dependencies between them.
+	PhaseRun Phase = "run"
+	// PhaseReady is the readiness gate of a service others depend on.
+	PhaseReady Phase = "ready"
+	// PhaseStop is the service's Stop call.
+	PhaseStop Phase = "stop"
 )
+
+// ServiceError reports which service failed, in which phase, after
+// how many Run attempts and how long the phase took. It is what Run
+// returns for a service failure, wrapped, so callers can find it
+// with errors.As. Besides Err it matches ErrMaxRetriesReached when a
+// service ran out of retries, and ErrStopTimeout when its Stop did
+// not return in time. ExitCode is what an ExitCoder service mapped
+// Err to, or 0.
+type ServiceError struct {
+	Service  string
+	Phase    Phase
+	Attempts int
+	Duration time.Duration
+	ExitCode int
+	Err      error
+
+	sentinel error
+}
+
+func (e *ServiceError) Error() string {
+	msg := fmt.Sprintf("service %s: %s failed", e.Service, e.Phase)
+	if e.Attempts > 0 {
+		msg += fmt.Sprintf(" after %d attempt(s)", e.Attempts)
+	}
+
+	msg += " in " + e.Duration.Round(time.Millisecond).String()
+
+	if e.sentinel != nil {
+		msg += ": " + e.sentinel.Error()
+	}
+
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+
+	return msg
+}
+
+func (e *ServiceError) Unwrap() []error {
+	var errs []error
+
+	if e.sentinel != nil {
+		errs = append(errs, e.sentinel)
+	}
+
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+
+	return errs
+}
+
+// ReadinessError reports a dependency that never became ready
+// and the dependents whose startup it blocked. Err wraps
+// ErrReadyTimeout or ErrExitedBeforeReady.
+type ReadinessError struct {
+	Service    string
+	Dependents []string
+	Err        error
+}
+
+func (e *ReadinessError) Error() string {
+	return fmt.Sprintf(
+		"service %s not ready, blocking %s: %v",
+		e.Service, strings.Join(e.Dependents, ", "), e.Err,
+	)
+}
+
+func (e *ReadinessError) Unwrap() error {
+	return e.Err
+}
+
+// PanicError is a panic recovered from a service's Run, with the
+// stack of the goroutine that panicked, captured as it was
+// recovered. It matches ErrServicePanic, and unwraps to Value when
+// that is an error. CrashFile is where it was written, when
+// SERVICEMANAGER_CRASHDIR is set and writing worked.
+type PanicError struct {
+	Service   string
+	Value     any
+	Stack     []byte
+	CrashFile string
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrServicePanic, e.Value)
+}
+
+func (e *PanicError) Is(target error) bool {
+	return target == ErrServicePanic
+}
+
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+
+	return err
+}
+
+// DependencyLostError reports a dependency that failed, or exited
+// to be restarted, under a running service. It is the cause of the
+// service's cancelled context, and the service's own failure when
+// the dependency does not come back. It matches ErrDependencyLost;
+// Err is why the dependency went down.
+type DependencyLostError struct {
+	Service    string
+	Dependency string
+	Err        error
+}
+
+func (e *DependencyLostError) Error() string {
+	msg := fmt.Sprintf(
+		"service %s lost dependency %s", e.Service, e.Dependency,
+	)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+
+	return msg
+}
+
+func (e *DependencyLostError) Is(target error) bool {
+	return target == ErrDependencyLost
+}
+
+func (e *DependencyLostError) Unwrap() error {
+	return e.Err
+}
+
+// SiblingError is the cause of a service's cancelled context when
+// another service brought it down. It matches ErrSiblingFailed when
+// that service failing for good ends Run, and
+// ErrRestartedWithSibling when the supervision strategy restarts it
+// along with that service. Service names the other service when it
+// is known; Err is why it went down, nil after a clean exit.
+type SiblingError struct {
+	Service string
+	Err     error
+
+	sentinel error
+}
+
+func (e *SiblingError) Error() string {
+	msg := e.sentinel.Error()
+	if e.Service != "" {
+		msg += ": " + e.Service
+	}
+
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+
+	return msg
+}
+
+func (e *SiblingError) Is(target error) bool {
+	return target == e.sentinel
+}
+
+func (e *SiblingError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent marks err as unrecoverable: a service whose Run
+// returns it, however deeply wrapped, is not retried or restarted
+// and goes straight to its failure handling. Permanent(nil) is nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err, or anything it wraps, was marked
+// with Permanent.
+func IsPermanent(err error) bool {
+	var pe *permanentError
+
+	return errors.As(err, &pe)
+}
+
+// Degraded marks a CheckHealth error as degraded rather than
+// unhealthy: the service works, but not fully. Degraded(nil) is
+// nil.
+func Degraded(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &degradedError{err: err}
+}
+
+// IsDegraded reports whether err, or anything it wraps, was marked
+// with Degraded.
+func IsDegraded(err error) bool {
+	var de *degradedError
+
+	return errors.As(err, &de)
+}
+
+type degradedError struct {
+	err error
+}
+
+func (e *degradedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *degradedError) Unwrap() error {
+	return e.err
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
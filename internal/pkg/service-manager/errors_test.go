@@ -2,9 +2,12 @@ package servicemanager
 
 import (
 	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -96,3 +99,87 @@ func TestErrorTypes(t *testing.T) {
 		assert.Implements(t, (*error)(nil), ErrServiceNotFound)
 	})
 }
+
+func TestReadinessError(t *testing.T) {
+	err := &ReadinessError{
+		Service:    "db",
+		Dependents: []string{"api", "worker"},
+		Err:        ErrReadyTimeout,
+	}
+
+	assert.Equal(t,
+		"service db not ready, blocking api, worker: "+
+			"service readiness timed out",
+		err.Error(),
+	)
+	assert.ErrorIs(t, err, ErrReadyTimeout)
+	assert.NotErrorIs(t, err, ErrExitedBeforeReady)
+}
+
+func TestServiceError(t *testing.T) {
+	err := &ServiceError{
+		Service:  "db",
+		Phase:    PhaseRun,
+		Attempts: 3,
+		Duration: 1500 * time.Millisecond,
+		Err:      errTestDifferent,
+		sentinel: ErrMaxRetriesReached,
+	}
+
+	assert.Equal(t,
+		"service db: run failed after 3 attempt(s) in 1.5s: "+
+			"max retries reached: different error",
+		err.Error(),
+	)
+	assert.ErrorIs(t, err, ErrMaxRetriesReached)
+	assert.ErrorIs(t, err, errTestDifferent)
+	assert.NotErrorIs(t, err, ErrStopTimeout)
+
+	timeout := &ServiceError{
+		Service:  "db",
+		Phase:    PhaseStop,
+		Duration: time.Second,
+		sentinel: ErrStopTimeout,
+	}
+
+	assert.Equal(t,
+		"service db: stop failed in 1s: service stop timed out",
+		timeout.Error(),
+	)
+	assert.ErrorIs(t, timeout, ErrStopTimeout)
+}
+
+func TestSiblingError(t *testing.T) {
+	err := &SiblingError{
+		Service:  "db",
+		Err:      errTestDifferent,
+		sentinel: ErrSiblingFailed,
+	}
+
+	assert.Equal(t,
+		"another service failed: db: different error", err.Error(),
+	)
+	assert.ErrorIs(t, err, ErrSiblingFailed)
+	assert.ErrorIs(t, err, errTestDifferent)
+	assert.NotErrorIs(t, err, ErrRestartedWithSibling)
+
+	clean := &SiblingError{
+		Service:  "db",
+		sentinel: ErrRestartedWithSibling,
+	}
+
+	assert.Equal(t, "restarted with another service: db", clean.Error())
+	assert.ErrorIs(t, clean, ErrRestartedWithSibling)
+}
+
+func TestPermanent(t *testing.T) {
+	require.NoError(t, Permanent(nil))
+
+	err := Permanent(errTestDifferent)
+	assert.Equal(t, errTestDifferent.Error(), err.Error())
+	assert.ErrorIs(t, err, errTestDifferent)
+	assert.True(t, IsPermanent(err))
+	assert.True(t, IsPermanent(fmt.Errorf("load config: %w", err)))
+	assert.False(t, IsPermanent(errTestDifferent))
+	assert.False(t, IsPermanent(nil))
+}
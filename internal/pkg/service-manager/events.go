@@ -0,0 +1,191 @@
+package servicemanager
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType names a lifecycle transition.
+type EventType string
+
+const (
+	// EventInstantiated follows a successful factory call.
+	EventInstantiated EventType = "instantiated"
+	// EventStarted precedes every Run call; Attempt counts them.
+	EventStarted EventType = "started"
+	// EventReady follows a ReadyNotifier closing its channel.
+	EventReady EventType = "ready"
+	// EventFailed follows the last failed attempt.
+	EventFailed EventType = "failed"
+	// EventRetryScheduled follows a failed attempt that is retried
+	// after Delay.
+	EventRetryScheduled EventType = "retry-scheduled"
+	// EventExited follows Run returning nil on its own.
+	EventExited EventType = "exited"
+	// EventExecuted follows a scheduled run of a Scheduled service,
+	// retries included; Attempt counts its Run calls and Err is the
+	// error of the last one.
+	EventExecuted EventType = "executed"
+	// EventExecutionSkipped reports a scheduled run dropped because
+	// the previous one still ran.
+	EventExecutionSkipped EventType = "execution-skipped"
+	// EventDrainStarted precedes the Drain call of a Drainer.
+	EventDrainStarted EventType = "drain-started"
+	// EventDrainFinished follows Drain returning; Err is its error.
+	EventDrainFinished EventType = "drain-finished"
+	// EventDrainTimedOut reports Drain outliving the drain timeout,
+	// Timeout; Err is ErrDrainTimeout. The service is stopped anyway.
+	EventDrainTimedOut EventType = "drain-timed-out"
+	// EventStopStarted precedes the Stop call.
+	EventStopStarted EventType = "stop-started"
+	// EventStopFinished follows Stop returning; Err is its error,
+	// as a *ServiceError.
+	EventStopFinished EventType = "stop-finished"
+	// EventStopTimedOut reports Stop outliving Timeout; Err is a
+	// *ServiceError matching ErrStopTimeout. Stop may still finish
+	// later.
+	EventStopTimedOut EventType = "stop-timed-out"
+	// EventPanicRecovered follows a recovered panic in Run.
+	EventPanicRecovered EventType = "panic-recovered"
+	// EventHealthChanged follows a CheckHealth whose Health differs
+	// from the previous check of the attempt; Err is its error.
+	EventHealthChanged EventType = "health-changed"
+	// EventDependencyLost follows an attempt cancelled because
+	// Dependency went down.
+	EventDependencyLost EventType = "dependency-lost"
+)
+
+// defaultEventBuffer is the buffer Observe gives each observer.
+const defaultEventBuffer = 64
+
+// Event is one lifecycle transition of one service. Fields that
+// do not apply to Type are zero.
+type Event struct {
+	Type    EventType
+	Service string
+	Time    time.Time
+	Attempt int
+	Err     error
+	// AllowedFailure marks an EventFailed the app survives.
+	AllowedFailure bool
+	// Delay is the wait before the next attempt.
+	Delay time.Duration
+	// Timeout is the stop or drain timeout that was exceeded.
+	Timeout time.Duration
+	// Dependency is the service whose loss an event reports.
+	Dependency string
+	// Health is the state a health check reported.
+	Health HealthState
+	// Dropped counts events this subscriber missed, because its
+	// buffer was full, since the previous one it received.
+	Dropped int
+}
+
+// Observer receives lifecycle events on its own goroutine.
+type Observer interface {
+	OnEvent(event Event)
+}
+
+// ObserverFunc adapts a function to Observer.
+type ObserverFunc func(event Event)
+
+func (f ObserverFunc) OnEvent(event Event) {
+	f(event)
+}
+
+// Subscribe returns a channel of lifecycle events with the given
+// buffer and a function that ends the subscription and closes the
+// channel. Delivery never blocks supervision: when the buffer is
+// full the event is dropped and counted in the next one's Dropped.
+func (s *ServiceManager) Subscribe(
+	buffer int,
+) (<-chan Event, func()) {
+	return s.events.subscribe(buffer)
+}
+
+// Observe calls observer for every lifecycle event until the
+// returned function is called. Events are buffered as with
+// Subscribe, so a slow observer only misses events. The returned
+// function waits for the observer to return, so OnEvent must not
+// call it directly: it would wait on itself. From OnEvent, call it
+// on another goroutine.
+func (s *ServiceManager) Observe(observer Observer) func() {
+	events, unsubscribe := s.events.subscribe(defaultEventBuffer)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for event := range events {
+			observer.OnEvent(event)
+		}
+	}()
+
+	return func() {
+		unsubscribe()
+		<-done
+	}
+}
+
+func (s *ServiceManager) emit(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	s.events.publish(event)
+}
+
+type subscription struct {
+	ch      chan Event
+	dropped int
+}
+
+// eventBus fans events out to subscribers without blocking the
+// publisher.
+type eventBus struct {
+	mu   sync.Mutex
+	subs map[*subscription]struct{}
+}
+
+func (b *eventBus) subscribe(buffer int) (<-chan Event, func()) {
+	sub := &subscription{ch: make(chan Event, max(buffer, 0))}
+
+	b.mu.Lock()
+
+	if b.subs == nil {
+		b.subs = make(map[*subscription]struct{})
+	}
+
+	b.subs[sub] = struct{}{}
+
+	b.mu.Unlock()
+
+	var once sync.Once
+
+	return sub.ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			delete(b.subs, sub)
+			close(sub.ch)
+		})
+	}
+}
+
+func (b *eventBus) publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs {
+		event.Dropped = sub.dropped
+
+		select {
+		case sub.ch <- event:
+			sub.dropped = 0
+		default:
+			sub.dropped++
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package servicemanager
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collectEvents drains events until it closes and returns them
+// grouped by service.
+func collectEvents(events <-chan Event) map[string][]EventType {
+	byService := map[string][]EventType{}
+
+	for event := range events {
+		byService[event.Service] = append(
+			byService[event.Service], event.Type,
+		)
+	}
+
+	return byService
+}
+
+func TestServiceManager_Subscribe(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	db := NewReadyMockService("db")
+
+	sm.Register("db", func() (Service, error) {
+		return db, nil
+	})
+
+	sm.Register("flaky", func() (Service, error) {
+		flaky := NewFullMockService("flaky").
+			WithMaxRetries(1).
+			WithAllowFailure(true)
+		flaky.WithRunError(errTestService)
+
+		return flaky, nil
+	})
+
+	sm.Register("oneshot", func() (Service, error) {
+		oneshot := NewFullMockService("oneshot").WithAllowFailure(true)
+		oneshot.WithOnRun(func() { panic("boom") })
+
+		return oneshot, nil
+	})
+
+	events, unsubscribe := sm.Subscribe(256)
+
+	runDone, cancel := runInBackground(t, sm)
+
+	waitForState(t, sm, "flaky", StateAllowedFailed)
+	waitForState(t, sm, "oneshot", StateAllowedFailed)
+	waitForState(t, sm, "db", StateStarting)
+
+	db.SignalReady()
+	waitForState(t, sm, "db", StateReady)
+
+	cancel()
+
+	require.NoError(t, waitForRun(t, runDone))
+
+	unsubscribe()
+
+	got := collectEvents(events)
+
+	assert.Equal(t, []EventType{
+		EventInstantiated, EventStarted, EventReady,
+		EventStopStarted, EventStopFinished,
+	}, got["db"])
+	assert.Equal(t, []EventType{
+		EventInstantiated, EventStarted, EventRetryScheduled,
+		EventStarted, EventFailed,
+		EventStopStarted, EventStopFinished,
+	}, got["flaky"])
+	assert.Equal(t, []EventType{
+		EventInstantiated, EventStarted, EventPanicRecovered, EventFailed,
+		EventStopStarted, EventStopFinished,
+	}, got["oneshot"])
+}
+
+func TestServiceManager_ObserverStopsItself(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	var (
+		stop    func()
+		calls   atomic.Int32
+		stopped = make(chan struct{})
+	)
+
+	stop = sm.Observe(ObserverFunc(func(Event) {
+		if calls.Add(1) == 1 {
+			go func() {
+				stop()
+				close(stopped)
+			}()
+		}
+	}))
+
+	sm.emit(Event{Type: EventStarted})
+
+	select {
+	case <-stopped:
+	case <-time.After(runHangGuard):
+		require.FailNow(t, "stop called from OnEvent did not return")
+	}
+
+	sm.emit(Event{Type: EventExited})
+
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestEventBus_NeverBlocks(t *testing.T) {
+	var bus eventBus
+
+	events, unsubscribe := bus.subscribe(1)
+
+	for range 3 {
+		bus.publish(Event{Type: EventStarted})
+	}
+
+	first := <-events
+	assert.Zero(t, first.Dropped)
+
+	bus.publish(Event{Type: EventExited})
+
+	second := <-events
+	assert.Equal(t, EventExited, second.Type)
+	assert.Equal(t, 2, second.Dropped)
+
+	unsubscribe()
+	unsubscribe()
+
+	_, open := <-events
+	assert.False(t, open)
+
+	bus.publish(Event{Type: EventStarted})
+}
@@ -0,0 +1,154 @@
+package servicemanager
+
+import (
+	"context"
+	"time"
+
+	"github.com/psyb0t/ctxerrors"
+	"github.com/psyb0t/ctxscope"
+)
+
+// HealthState is how well a service, or the whole app, works.
+type HealthState string
+
+const (
+	// HealthOK services work as intended.
+	HealthOK HealthState = "healthy"
+	// HealthDegraded services work, but not fully. An app is
+	// degraded while any service is, or while an AllowedFailure
+	// service is unhealthy.
+	HealthDegraded HealthState = "degraded"
+	// HealthUnhealthy services do not work: they report so, or are
+	// not running. An app is unhealthy while any service that is
+	// not allowed to fail is.
+	HealthUnhealthy HealthState = "unhealthy"
+)
+
+const defaultHealthInterval = 10 * time.Second
+
+// ServiceHealth is how well one service works.
+type ServiceHealth struct {
+	State HealthState
+	// Reason explains any state but HealthOK.
+	Reason string
+	// CheckedAt is when CheckHealth last returned. It is zero
+	// without a HealthReporter, and while the service is not
+	// running its checks do not count.
+	CheckedAt time.Time
+}
+
+// HealthReport is the health of the app and of every service in
+// the live graph, ordered like Status.
+type HealthReport struct {
+	State    HealthState
+	Services []ServiceStatus
+}
+
+// Health aggregates the health of every service in the live graph.
+// A service that runs is as healthy as its last CheckHealth says,
+// or healthy without a HealthReporter; one that is pending,
+// starting, retrying, failed, draining or stopping is unhealthy, one
+// that stopped is healthy, and one waiting for its next scheduled
+// run is degraded after a failed run. An AllowedFailure service only ever
+// degrades the app, so it shows up instead of silently vanishing.
+func (s *ServiceManager) Health() HealthReport {
+	statuses := s.Status()
+
+	return HealthReport{
+		State:    aggregateHealth(statuses),
+		Services: statuses,
+	}
+}
+
+func aggregateHealth(statuses []ServiceStatus) HealthState {
+	state := HealthOK
+
+	for _, status := range statuses {
+		switch {
+		case status.Health.State == HealthOK:
+		case status.Health.State == HealthUnhealthy &&
+			!status.AllowedFailure:
+			return HealthUnhealthy
+		default:
+			state = HealthDegraded
+		}
+	}
+
+	return state
+}
+
+// pollHealth checks a running attempt's health right away and then
+// every health interval until the attempt ends.
+func (s *ServiceManager) pollHealth(
+	ctx context.Context,
+	name string,
+	hr HealthReporter,
+) {
+	ticker := time.NewTicker(s.healthInterval)
+	defer ticker.Stop()
+
+	for {
+		s.checkHealth(ctx, name, hr)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkHealth runs one check, bounded by the health interval, and
+// records its result. A change of state is logged and emitted.
+func (s *ServiceManager) checkHealth(
+	ctx context.Context,
+	name string,
+	hr HealthReporter,
+) {
+	checkCtx, cancel := context.WithTimeout(ctx, s.healthInterval)
+	defer cancel()
+
+	err := safeCheckHealth(checkCtx, hr)
+	if ctx.Err() != nil {
+		return
+	}
+
+	health := ServiceHealth{State: HealthOK, CheckedAt: time.Now()}
+
+	switch {
+	case err == nil:
+	case IsDegraded(err):
+		health.State = HealthDegraded
+		health.Reason = err.Error()
+	default:
+		health.State = HealthUnhealthy
+		health.Reason = err.Error()
+	}
+
+	if !s.status.checked(name, health) {
+		return
+	}
+
+	ctxscope.GetLogger(ctx).Info("service health changed",
+		"health", health.State,
+		"err", err,
+	)
+
+	s.emit(Event{
+		Type:    EventHealthChanged,
+		Service: name,
+		Health:  health.State,
+		Err:     err,
+	})
+}
+
+// safeCheckHealth turns a panicking check into an unhealthy one.
+func safeCheckHealth(ctx context.Context, hr HealthReporter) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = ctxerrors.Wrapf(ErrServicePanic, "health check: %v", r)
+		}
+	}()
+
+	return hr.CheckHealth(ctx) //nolint:wrapcheck
+}
@@ -0,0 +1,183 @@
+package servicemanager
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errSlowQueries = errors.New("slow queries")
+
+// healthReportingService runs until cancelled and reports whatever
+// health it was last given.
+type healthReportingService struct {
+	Service
+	mu  sync.Mutex
+	err error
+}
+
+func (h *healthReportingService) Run(ctx context.Context) error {
+	<-ctx.Done()
+
+	return nil
+}
+
+func (h *healthReportingService) CheckHealth(context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.err
+}
+
+func (h *healthReportingService) report(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.err = err
+}
+
+func waitForHealth(
+	t *testing.T,
+	sm *ServiceManager,
+	want HealthState,
+) HealthReport {
+	t.Helper()
+
+	var report HealthReport
+
+	require.Eventually(t, func() bool {
+		report = sm.Health()
+
+		return report.State == want
+	}, runHangGuard, startedPollInterval,
+		"app never became %s", want)
+
+	return report
+}
+
+func TestServiceManager_HealthReporter(t *testing.T) {
+	t.Setenv("SERVICEMANAGER_HEALTHINTERVAL", "5ms")
+
+	ResetInstance()
+
+	sm := GetInstance()
+
+	db := &healthReportingService{Service: NewTestService("db")}
+	sm.Add(db, NewTestService("api"))
+
+	events, unsubscribe := sm.Subscribe(64)
+	defer unsubscribe()
+
+	nextChange := func() HealthState {
+		t.Helper()
+
+		for {
+			select {
+			case event := <-events:
+				if event.Type == EventHealthChanged {
+					return event.Health
+				}
+			case <-time.After(runHangGuard):
+				t.Fatal("health never changed")
+
+				return ""
+			}
+		}
+	}
+
+	stop := runControlled(t, sm, 2)
+	defer stop()
+
+	assert.Equal(t, HealthOK, nextChange())
+	waitForHealth(t, sm, HealthOK)
+
+	db.report(Degraded(errSlowQueries))
+	assert.Equal(t, HealthDegraded, nextChange())
+
+	report := sm.Health()
+	assert.Equal(t, HealthDegraded, report.State)
+	require.Len(t, report.Services, 2)
+	assert.Equal(t, "api", report.Services[0].Name)
+	assert.Equal(t, HealthOK, report.Services[0].Health.State)
+	assert.Equal(t, HealthDegraded, report.Services[1].Health.State)
+	assert.Equal(t, "slow queries", report.Services[1].Health.Reason)
+	assert.False(t, report.Services[1].Health.CheckedAt.IsZero())
+
+	db.report(errTestService)
+	assert.Equal(t, HealthUnhealthy, nextChange())
+	assert.Equal(t, HealthUnhealthy, sm.Health().State)
+
+	db.report(nil)
+	assert.Equal(t, HealthOK, nextChange())
+	assert.Equal(t, HealthOK, sm.Health().State)
+}
+
+func TestServiceManager_AllowedFailureDegrades(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	optional := NewFullMockService("optional").WithAllowFailure(true)
+	optional.WithRunError(errTestService)
+
+	sm.Add(optional, NewTestService("api"))
+
+	stop := runControlled(t, sm, 2)
+	defer stop()
+
+	waitForState(t, sm, "optional", StateAllowedFailed)
+	waitForState(t, sm, "api", StateRunning)
+
+	report := sm.Health()
+	assert.Equal(t, HealthDegraded, report.State)
+
+	for _, status := range report.Services {
+		if status.Name != "optional" {
+			continue
+		}
+
+		assert.True(t, status.AllowedFailure)
+		assert.Equal(t, HealthUnhealthy, status.Health.State)
+		assert.Contains(t, status.Health.Reason, "allowed-failed")
+	}
+}
+
+func TestAggregateHealth(t *testing.T) {
+	status := func(state HealthState, allowed bool) ServiceStatus {
+		return ServiceStatus{
+			Health:         ServiceHealth{State: state},
+			AllowedFailure: allowed,
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		statuses []ServiceStatus
+		want     HealthState
+	}{
+		{"no services", nil, HealthOK},
+		{"all healthy", []ServiceStatus{
+			status(HealthOK, false), status(HealthOK, true),
+		}, HealthOK},
+		{"one degraded", []ServiceStatus{
+			status(HealthOK, false), status(HealthDegraded, false),
+		}, HealthDegraded},
+		{"allowed failure unhealthy", []ServiceStatus{
+			status(HealthOK, false), status(HealthUnhealthy, true),
+		}, HealthDegraded},
+		{"required service unhealthy", []ServiceStatus{
+			status(HealthDegraded, false), status(HealthUnhealthy, false),
+		}, HealthUnhealthy},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, aggregateHealth(tc.statuses))
+		})
+	}
+}
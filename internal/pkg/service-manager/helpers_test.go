@@ -0,0 +1,169 @@
+package servicemanager
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// runInBackground starts Run and returns the channel its result
+// arrives on and the function that cancels it.
+func runInBackground(
+	t *testing.T,
+	sm *ServiceManager,
+) (<-chan error, context.CancelFunc) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	runDone := make(chan error, 1)
+
+	go func() {
+		runDone <- sm.Run(ctx)
+	}()
+
+	return runDone, cancel
+}
+
+// waitForRun returns what Run returned on runDone.
+func waitForRun(t *testing.T, runDone <-chan error) error {
+	t.Helper()
+
+	select {
+	case err := <-runDone:
+		return err
+	case <-time.After(runHangGuard):
+		t.Fatal("Run did not return")
+
+		return nil
+	}
+}
+
+// runControlled starts Run in the background, waits for want
+// services to launch and returns a function that cancels Run and
+// checks it returned cleanly.
+func runControlled(
+	t *testing.T,
+	sm *ServiceManager,
+	want int,
+) func() {
+	t.Helper()
+
+	runDone, cancel := runInBackground(t, sm)
+	waitForStartedServices(t, sm, want)
+
+	return func() {
+		cancel()
+		assert.NoError(t, waitForRun(t, runDone))
+	}
+}
+
+// crashingService fails its first Run with errTestService when
+// crash is closed. It retries once.
+type crashingService struct {
+	Service
+	crash   <-chan struct{}
+	crashed atomic.Bool
+	deps    []string
+}
+
+func (c *crashingService) Run(ctx context.Context) error {
+	crash := c.crash
+	if c.crashed.Load() {
+		crash = nil
+	}
+
+	select {
+	case <-crash:
+		c.crashed.Store(true)
+
+		return errTestService
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+func (c *crashingService) MaxRetries() int { return 1 }
+
+func (c *crashingService) RetryDelay() time.Duration { return 0 }
+
+func (c *crashingService) Dependencies() []string { return c.deps }
+
+// serviceFixture registers db and api (api depends on db) as
+// factories, so every start builds a fresh instance, and records
+// how often each was built and the order they stopped in. The
+// first db instance crashes when crash is closed; later ones run
+// until stopped.
+type serviceFixture struct {
+	sm        *ServiceManager
+	mu        sync.Mutex
+	built     map[string]int
+	stopOrder []string
+	crash     chan struct{}
+}
+
+func newServiceFixture(sm *ServiceManager) *serviceFixture {
+	f := &serviceFixture{
+		sm:    sm,
+		built: map[string]int{},
+		crash: make(chan struct{}),
+	}
+
+	f.register("db")
+	f.register("api", "db")
+
+	return f
+}
+
+// register adds a factory for name, which depends on deps.
+func (f *serviceFixture) register(name string, deps ...string) {
+	f.sm.Register(name, func() (Service, error) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		f.built[name]++
+
+		crash := make(chan struct{})
+		if name == "db" && f.built[name] == 1 {
+			crash = f.crash
+		}
+
+		return &crashingService{
+			Service: &stopTrackingService{
+				Service: NewTestService(name),
+				onStop:  func() { f.recordStop(name) },
+			},
+			crash: crash,
+			deps:  deps,
+		}, nil
+	})
+}
+
+func (f *serviceFixture) recordBuild(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.built[name]++
+}
+
+func (f *serviceFixture) recordStop(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.stopOrder = append(f.stopOrder, name)
+}
+
+func (f *serviceFixture) snapshot() (map[string]int, []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	built := make(map[string]int, len(f.built))
+	for name, n := range f.built {
+		built[name] = n
+	}
+
+	return built, append([]string(nil), f.stopOrder...)
+}
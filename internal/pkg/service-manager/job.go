@@ -0,0 +1,101 @@
+package servicemanager
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/psyb0t/ctxerrors"
+)
+
+func isJob(service Service) bool {
+	j, ok := service.(Job)
+
+	return ok && j.IsJob()
+}
+
+// finish records that run ended on its own for good, by returning
+// nil without a restart or by failing while allowed to, and
+// completes Run when that was the last work of a graph with jobs.
+func (s *ServiceManager) finish(run *serviceRun) {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+
+	run.finished = true
+	s.completeIfFinished()
+}
+
+// completeIfFinished closes the completion channel of Run once the
+// live graph holds a job and every service in it has finished. A
+// daemon, a service stopped through the control API and one being
+// restarted all hold it open. Callers hold runsMu.
+func (s *ServiceManager) completeIfFinished() {
+	if s.completed == nil || s.stopping {
+		return
+	}
+
+	hasJob := false
+
+	for _, run := range s.runs {
+		if !run.finished {
+			return
+		}
+
+		hasJob = hasJob || isJob(run.service)
+	}
+
+	if !hasJob {
+		return
+	}
+
+	close(s.completed)
+	s.completed = nil
+}
+
+// jobDeadline returns a channel that fires once SERVICEMANAGER_JOBTIMEOUT
+// has passed since Run started, and the function that releases it.
+// The channel is nil, and never fires, without a timeout or when
+// none of services is a job.
+func (s *ServiceManager) jobDeadline(
+	services map[string]Service,
+) (<-chan time.Time, func()) {
+	if s.jobTimeout <= 0 {
+		return nil, func() {}
+	}
+
+	hasJob := false
+
+	for _, service := range services {
+		hasJob = hasJob || isJob(service)
+	}
+
+	if !hasJob {
+		return nil, func() {}
+	}
+
+	timer := time.NewTimer(s.jobTimeout)
+
+	return timer.C, func() { timer.Stop() }
+}
+
+// jobTimedOut is the error Run fails with when its jobs outlive
+// the job timeout. It names the jobs that had not finished.
+func (s *ServiceManager) jobTimedOut() error {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+
+	var unfinished []string
+
+	for name, run := range s.runs {
+		if isJob(run.service) && !run.finished {
+			unfinished = append(unfinished, name)
+		}
+	}
+
+	slices.Sort(unfinished)
+
+	return ctxerrors.Wrapf(
+		ErrJobTimeout, "after %s, unfinished: %s",
+		s.jobTimeout, strings.Join(unfinished, ", "),
+	)
+}
@@ -0,0 +1,185 @@
+package servicemanager
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// noRunReturn is how long a test waits to be sure Run keeps going.
+const noRunReturn = 50 * time.Millisecond
+
+// jobService is a Job whose Run call n returns results[n-1], and
+// nil past them.
+type jobService struct {
+	Service
+	results []error
+	deps    []string
+	allowed bool
+	runs    atomic.Int32
+}
+
+func (j *jobService) Run(context.Context) error {
+	if n := int(j.runs.Add(1)); n <= len(j.results) {
+		return j.results[n-1]
+	}
+
+	return nil
+}
+
+func (j *jobService) IsJob() bool { return true }
+
+func (j *jobService) MaxRetries() int { return 1 }
+
+func (j *jobService) RetryDelay() time.Duration { return 0 }
+
+func (j *jobService) Dependencies() []string { return j.deps }
+
+func (j *jobService) IsAllowedFailure() bool { return j.allowed }
+
+// exitingService is a daemon whose Run returns nil at once.
+type exitingService struct {
+	Service
+}
+
+func (e *exitingService) Run(context.Context) error { return nil }
+
+// blockingJob is a Job that runs until cancelled.
+type blockingJob struct {
+	*lossRecordingService
+}
+
+func (b *blockingJob) IsJob() bool { return true }
+
+func TestServiceManager_JobsRunToCompletion(t *testing.T) {
+	testCases := []struct {
+		name     string
+		services func() []Service
+	}{
+		{
+			name: "dependent jobs",
+			services: func() []Service {
+				return []Service{
+					&jobService{Service: NewTestService("migrate")},
+					&jobService{
+						Service: NewTestService("report"),
+						deps:    []string{"migrate"},
+					},
+				}
+			},
+		},
+		{
+			name: "retried job",
+			services: func() []Service {
+				return []Service{&jobService{
+					Service: NewTestService("backup"),
+					results: []error{errTestService},
+				}}
+			},
+		},
+		{
+			name: "allowed failure",
+			services: func() []Service {
+				return []Service{
+					&jobService{Service: NewTestService("backup")},
+					&jobService{
+						Service: NewTestService("notify"),
+						results: []error{errTestService, errTestService},
+						allowed: true,
+					},
+				}
+			},
+		},
+		{
+			name: "daemon that exits",
+			services: func() []Service {
+				return []Service{
+					&jobService{Service: NewTestService("backup")},
+					&exitingService{NewTestService("daemon")},
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ResetInstance()
+
+			sm := GetInstance()
+			sm.Add(tc.services()...)
+
+			runDone, cancel := runInBackground(t, sm)
+			defer cancel()
+
+			require.NoError(t, waitForRun(t, runDone))
+		})
+	}
+}
+
+func TestServiceManager_DaemonHoldsJobsOpen(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+	sm.Add(
+		&jobService{Service: NewTestService("backup")},
+		newLossRecordingService("daemon", ""),
+	)
+
+	runDone, cancel := runInBackground(t, sm)
+	defer cancel()
+
+	waitForState(t, sm, "backup", StateStopped)
+
+	select {
+	case err := <-runDone:
+		t.Fatalf("Run returned while a daemon ran: %v", err)
+	case <-time.After(noRunReturn):
+	}
+
+	require.NoError(t, sm.RemoveService(t.Context(), "daemon"))
+	require.NoError(t, waitForRun(t, runDone))
+}
+
+func TestServiceManager_NoJobsKeepsRunning(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+	sm.Add(&exitingService{NewTestService("migrate")})
+
+	runDone, cancel := runInBackground(t, sm)
+
+	waitForState(t, sm, "migrate", StateStopped)
+
+	select {
+	case err := <-runDone:
+		t.Fatalf("Run returned without jobs: %v", err)
+	case <-time.After(noRunReturn):
+	}
+
+	cancel()
+	require.NoError(t, waitForRun(t, runDone))
+}
+
+func TestServiceManager_JobTimeout(t *testing.T) {
+	t.Setenv("SERVICEMANAGER_JOBTIMEOUT", "20ms")
+
+	ResetInstance()
+
+	sm := GetInstance()
+
+	stuck := &blockingJob{newLossRecordingService("stuck", "")}
+	sm.Add(stuck, &jobService{Service: NewTestService("done")})
+
+	runDone, cancel := runInBackground(t, sm)
+	defer cancel()
+
+	err := waitForRun(t, runDone)
+	require.ErrorIs(t, err, ErrJobTimeout)
+	assert.Contains(t, err.Error(), "unfinished: stuck")
+	assert.NotContains(t, err.Error(), "done")
+	require.ErrorIs(t, stuck.firstCause(), ErrJobTimeout)
+}
@@ -283,8 +283,9 @@ func (f *FullMockService) Dependencies() []string {
 
 type ReadyMockService struct {
 	*MockService
-	readyCh chan struct{}
-	deps    []string
+	readyCh      chan struct{}
+	deps         []string
+	readyTimeout time.Duration
 }
 
 func NewReadyMockService(
@@ -298,6 +299,18 @@ func NewReadyMockService(
 	}
 }
 
+func (r *ReadyMockService) WithReadyTimeout(
+	d time.Duration,
+) *ReadyMockService {
+	r.readyTimeout = d
+
+	return r
+}
+
+func (r *ReadyMockService) ReadyTimeout() time.Duration {
+	return r.readyTimeout
+}
+
 func (r *ReadyMockService) Ready() <-chan struct{} {
 	return r.readyCh
 }
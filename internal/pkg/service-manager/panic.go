@@ -0,0 +1,93 @@
+package servicemanager
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/psyb0t/ctxscope"
+)
+
+// PanicPolicy decides what a panic in a service's Run leads to.
+type PanicPolicy string
+
+const (
+	// RecoverAndRetry turns the panic into a *PanicError that the
+	// service's restart policy handles like any other failure. It is
+	// the default.
+	RecoverAndRetry PanicPolicy = "recover"
+	// RecoverAndFail turns it into a permanent *PanicError, so the
+	// service fails at once even when it is Retryable.
+	RecoverAndFail PanicPolicy = "fail-fast"
+	// Repanic crashes the process with the original panic and its
+	// stack, once the panic is logged and any crash file written.
+	Repanic PanicPolicy = "repanic"
+)
+
+func (p PanicPolicy) valid() bool {
+	switch p {
+	case RecoverAndRetry, RecoverAndFail, Repanic:
+		return true
+	}
+
+	return false
+}
+
+// panicPolicyFor returns the policy of service, or the manager's
+// when the service has no valid one of its own.
+func (s *ServiceManager) panicPolicyFor(service Service) PanicPolicy {
+	h, ok := service.(PanicHandler)
+	if ok && h.PanicPolicy().valid() {
+		return h.PanicPolicy()
+	}
+
+	return s.panicPolicy
+}
+
+const (
+	crashDirPerm  = 0o750
+	crashFilePerm = 0o600
+)
+
+// writeCrashFile writes a recovered panic to a file of its own in
+// the crash directory and returns its path. It returns "" when no
+// crash directory is set or the file could not be written; the
+// panic is logged either way.
+func (s *ServiceManager) writeCrashFile(
+	ctx context.Context,
+	pe *PanicError,
+) string {
+	if s.crashDir == "" {
+		return ""
+	}
+
+	now := time.Now().UTC()
+	name := fmt.Sprintf("%s-%d.crash",
+		strings.ReplaceAll(pe.Service, string(filepath.Separator), "_"),
+		now.UnixNano(),
+	)
+	path := filepath.Join(s.crashDir, name)
+
+	report := fmt.Sprintf("service: %s\ntime: %s\npanic: %v\n\n%s",
+		pe.Service, now.Format(time.RFC3339Nano), pe.Value, pe.Stack,
+	)
+
+	err := os.MkdirAll(s.crashDir, crashDirPerm)
+	if err == nil {
+		err = os.WriteFile(path, []byte(report), crashFilePerm)
+	}
+
+	if err != nil {
+		ctxscope.GetLogger(ctx).Error("failed to write crash file",
+			"path", path,
+			"err", err,
+		)
+
+		return ""
+	}
+
+	return path
+}
@@ -0,0 +1,101 @@
+package servicemanager
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// retryablePanicService panics on every Run and retries twice.
+type retryablePanicService struct {
+	*TestService
+	policy PanicPolicy
+	runs   atomic.Int32
+}
+
+func (p *retryablePanicService) Run(context.Context) error {
+	p.runs.Add(1)
+
+	panic("oh no")
+}
+
+func (p *retryablePanicService) MaxRetries() int { return 2 }
+
+func (p *retryablePanicService) RetryDelay() time.Duration { return 0 }
+
+func (p *retryablePanicService) PanicPolicy() PanicPolicy { return p.policy }
+
+func TestServiceManager_PanicPolicy(t *testing.T) {
+	testCases := []struct {
+		name      string
+		env       PanicPolicy
+		service   PanicPolicy
+		runs      int32
+		permanent bool
+	}{
+		{"default recovers and retries", "", "", 3, false},
+		{"env fails fast", RecoverAndFail, "", 1, true},
+		{"service fails fast", "", RecoverAndFail, 1, true},
+		{"service overrides env", RecoverAndFail, RecoverAndRetry, 3, false},
+		{"unknown service policy", RecoverAndFail, "explode", 1, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("SERVICEMANAGER_PANICPOLICY", string(tc.env))
+
+			ResetInstance()
+
+			sm := GetInstance()
+			svc := &retryablePanicService{
+				TestService: NewTestService("panicker"),
+				policy:      tc.service,
+			}
+			sm.Add(svc)
+
+			err := sm.Run(t.Context())
+			require.ErrorIs(t, err, ErrServicePanic)
+
+			var pe *PanicError
+			require.ErrorAs(t, err, &pe)
+			assert.Equal(t, tc.permanent, IsPermanent(err))
+			assert.Equal(t, tc.runs, svc.runs.Load())
+		})
+	}
+}
+
+func TestServiceManager_Repanic(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+	sm.panicPolicy = Repanic
+
+	svc := &retryablePanicService{TestService: NewTestService("panicker")}
+
+	recovered := func() (r any) {
+		defer func() { r = recover() }()
+
+		_ = sm.safeRun(t.Context(), svc.Name(), svc)
+
+		return nil
+	}()
+
+	assert.Equal(t, "oh no", recovered)
+}
+
+func TestServiceManager_UnknownPanicPolicy(t *testing.T) {
+	t.Setenv("SERVICEMANAGER_PANICPOLICY", "shrug")
+
+	ResetInstance()
+
+	sm := GetInstance()
+	sm.Add(NewTestService("svc"))
+
+	err := sm.Run(t.Context())
+	require.ErrorIs(t, err, ErrUnknownPanicPolicy)
+	require.ErrorIs(t, err, ErrInvalidConfig)
+}
@@ -0,0 +1,438 @@
+package servicemanager
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/psyb0t/ctxerrors"
+	"github.com/psyb0t/ctxscope"
+	"github.com/psyb0t/gonfiguration"
+)
+
+// replicaSeparator joins the name of a replicated service and the
+// index of one of its instances.
+const replicaSeparator = "#"
+
+const (
+	envVarNameServicesReplicas = "SERVICES_REPLICAS"
+	envVarNameServicesQuorum   = "SERVICES_QUORUM"
+)
+
+// replicaName is the name instance i of the service name runs as.
+func replicaName(name string, i int) string {
+	return name + replicaSeparator + strconv.Itoa(i)
+}
+
+// replicaNames returns, in order, the names of the replicas of name
+// that are keys of m.
+func replicaNames[V any](m map[string]V, name string) []string {
+	var names []string
+
+	for i := 0; ; i++ {
+		replica := replicaName(name, i)
+		if _, ok := m[replica]; !ok {
+			return names
+		}
+
+		names = append(names, replica)
+	}
+}
+
+// instanceNames resolves name against m: to itself when it is a
+// key, otherwise to its replicas or to the instances of the
+// template it names.
+func instanceNames[V any](m map[string]V, name string) []string {
+	if _, ok := m[name]; ok {
+		return []string{name}
+	}
+
+	if names := replicaNames(m, name); len(names) > 0 {
+		return names
+	}
+
+	return templateInstanceNames(m, name)
+}
+
+// replicaConfig holds the replica counts and quorums set through
+// SERVICES_REPLICAS and SERVICES_QUORUM, by service name.
+type replicaConfig struct {
+	replicas map[string]int
+	quorum   map[string]int
+}
+
+func parseReplicaConfig() (replicaConfig, error) {
+	cfg := servicesConfig{}
+	if err := gonfiguration.Parse(&cfg); err != nil {
+		return replicaConfig{}, ctxerrors.Wrap(
+			errors.Join(ErrInvalidConfig, err), "parse service config",
+		)
+	}
+
+	replicas, err := parseServiceCounts(
+		envVarNameServicesReplicas, cfg.Replicas,
+	)
+	if err != nil {
+		return replicaConfig{}, err
+	}
+
+	quorum, err := parseServiceCounts(envVarNameServicesQuorum, cfg.Quorum)
+	if err != nil {
+		return replicaConfig{}, err
+	}
+
+	return replicaConfig{replicas: replicas, quorum: quorum}, nil
+}
+
+// parseServiceCounts reads name=count entries of the env var env.
+func parseServiceCounts(
+	env string,
+	entries []string,
+) (map[string]int, error) {
+	counts := make(map[string]int, len(entries))
+
+	for _, entry := range entries {
+		name, value, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || name == "" || err != nil || n < 1 {
+			return nil, ctxerrors.Wrapf(
+				ErrInvalidConfig, "%s: want name=count, got %q", env, entry,
+			)
+		}
+
+		counts[name] = n
+	}
+
+	return counts, nil
+}
+
+// forService returns how many instances of service, registered as
+// name, to run and how many of them its dependents need ready.
+func (c replicaConfig) forService(
+	name string,
+	service Service,
+) (int, int) {
+	count := 1
+
+	if r, ok := service.(Replicated); ok {
+		count = r.Replicas()
+	}
+
+	if n, ok := c.replicas[name]; ok {
+		count = n
+	}
+
+	count = max(count, 1)
+	quorum := count
+
+	if q, ok := service.(Quorate); ok && q.Quorum() > 0 {
+		quorum = q.Quorum()
+	}
+
+	if n, ok := c.quorum[name]; ok {
+		quorum = n
+	}
+
+	return count, min(quorum, count)
+}
+
+// instantiateReplicas calls factory once per instance of the
+// service name and adds the instances, as replicas when there are
+// several of them.
+func (s *ServiceManager) instantiateReplicas(
+	ctx context.Context,
+	name string,
+	factory ServiceFactory,
+	cfg replicaConfig,
+) error {
+	svc, err := instantiate(name, factory)
+	if err != nil {
+		return err
+	}
+
+	count, quorum := cfg.forService(name, svc)
+	if count == 1 {
+		s.emit(Event{Type: EventInstantiated, Service: name})
+		ctxscope.GetLogger(
+			withServiceScope(ctx, name),
+		).Debug("registering service")
+
+		s.servicesMutex.Lock()
+		s.services[name] = svc
+		s.servicesMutex.Unlock()
+
+		return nil
+	}
+
+	ctxscope.GetLogger(withServiceScope(ctx, name)).Debug(
+		"replicating service",
+		"replicas", count,
+		"quorum", quorum,
+	)
+
+	instances := make(map[string]Service, count)
+
+	for i := range count {
+		replica := replicaName(name, i)
+
+		if i > 0 {
+			if svc, err = instantiate(replica, factory); err != nil {
+				return err
+			}
+		}
+
+		s.emit(Event{Type: EventInstantiated, Service: replica})
+		ctxscope.GetLogger(
+			withServiceScope(ctx, replica),
+		).Debug("registering service")
+
+		instances[replica] = svc
+	}
+
+	s.servicesMutex.Lock()
+	defer s.servicesMutex.Unlock()
+
+	if s.quorums == nil {
+		s.quorums = make(map[string]int)
+	}
+
+	s.quorums[name] = quorum
+
+	for replica, svc := range instances {
+		s.services[replica] = svc
+	}
+
+	return nil
+}
+
+// dependencySet is one declared dependency of a service: a single
+// run, or the replicas of a replicated service of which quorum must
+// be up.
+type dependencySet struct {
+	name    string
+	members []string
+	quorum  int
+}
+
+func (d dependencySet) replicated() bool {
+	return len(d.members) > 1
+}
+
+// dependencySets groups deps, the resolved dependencies of a run,
+// by the declared dependency each of them came from, in order.
+func (s *ServiceManager) dependencySets(deps []string) []dependencySet {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+
+	sets := make([]dependencySet, 0, len(deps))
+	replicaSets := make(map[string]int)
+
+	for _, dep := range deps {
+		base, _, replica := strings.Cut(dep, replicaSeparator)
+		quorum, ok := s.runQuorums[base]
+
+		if !replica || !ok {
+			sets = append(sets, dependencySet{
+				name: dep, members: []string{dep}, quorum: 1,
+			})
+
+			continue
+		}
+
+		i, seen := replicaSets[base]
+		if !seen {
+			i = len(sets)
+			replicaSets[base] = i
+			sets = append(sets, dependencySet{name: base, quorum: quorum})
+		}
+
+		sets[i].members = append(sets[i].members, dep)
+	}
+
+	for i := range sets {
+		if !sets[i].replicated() {
+			sets[i].name = sets[i].members[0]
+		}
+
+		sets[i].quorum = min(sets[i].quorum, len(sets[i].members))
+	}
+
+	return sets
+}
+
+// waitQuorum blocks until quorum replicas of set are ready, each
+// judged as waitDependencyReady judges a single dependency. It
+// fails once so many replicas are gone that the quorum cannot be
+// met any more.
+func (s *ServiceManager) waitQuorum(
+	ctx context.Context,
+	dependent string,
+	set dependencySet,
+) (bool, error) {
+	for {
+		s.runsMu.Lock()
+
+		wake := []<-chan struct{}{s.runsChanged}
+		runs := make([]*serviceRun, len(set.members))
+		launched := make([]bool, len(set.members))
+
+		for i, name := range set.members {
+			runs[i] = s.runs[name]
+			launched[i] = runs[i] != nil && runs[i].launched
+		}
+
+		s.runsMu.Unlock()
+
+		var (
+			ready, gone int
+			lastErr     error
+		)
+
+		for i, run := range runs {
+			if run == nil {
+				gone++
+
+				continue
+			}
+
+			state := run.avail.state()
+			wake = append(wake, state.changed)
+
+			select {
+			case <-run.ready:
+				if replicaUp(run, state) {
+					ready++
+
+					continue
+				}
+			default:
+				wake = append(wake, run.ready)
+
+				if launched[i] {
+					state.gone = false
+				}
+			}
+
+			if state.gone {
+				gone++
+				lastErr = state.err
+			}
+		}
+
+		if ready >= set.quorum {
+			return true, nil
+		}
+
+		if len(runs)-gone < set.quorum {
+			return false, &DependencyLostError{
+				Service:    dependent,
+				Dependency: set.name,
+				Err:        lastErr,
+			}
+		}
+
+		if !waitAny(ctx, wake) {
+			return false, nil
+		}
+	}
+}
+
+// watchQuorum cancels an attempt of dependent once fewer replicas
+// of set than its quorum are up. Replicas may come and go as long
+// as enough of them stay up.
+func (s *ServiceManager) watchQuorum(
+	ctx context.Context,
+	dependent string,
+	set dependencySet,
+	cancel context.CancelCauseFunc,
+) {
+	for {
+		s.runsMu.Lock()
+
+		wake := []<-chan struct{}{s.runsChanged}
+		runs := make([]*serviceRun, 0, len(set.members))
+
+		for _, name := range set.members {
+			if run, ok := s.runs[name]; ok {
+				runs = append(runs, run)
+			}
+		}
+
+		s.runsMu.Unlock()
+
+		var (
+			up      int
+			lastErr error
+		)
+
+		for _, run := range runs {
+			state := run.avail.state()
+			wake = append(wake, state.changed)
+
+			switch {
+			case replicaUp(run, state):
+				up++
+			case state.err != nil:
+				lastErr = state.err
+			}
+		}
+
+		if up < set.quorum {
+			cancel(&DependencyLostError{
+				Service:    dependent,
+				Dependency: set.name,
+				Err:        lastErr,
+			})
+
+			return
+		}
+
+		if !waitAny(ctx, wake) {
+			return
+		}
+	}
+}
+
+// replicaUp reports whether run, in state, counts towards a quorum:
+// it is up, or its current attempt is ready and has not ended while
+// the mark that makes it up is still on its way.
+func replicaUp(run *serviceRun, state availabilityState) bool {
+	if state.up {
+		return true
+	}
+
+	rn, ok := run.service.(ReadyNotifier)
+	if !ok || state.gen == 0 || state.ended {
+		return false
+	}
+
+	select {
+	case <-rn.Ready():
+		return true
+	default:
+		return false
+	}
+}
+
+// waitAny blocks until one of chans is ready and reports whether
+// that happened before ctx was done.
+func waitAny(ctx context.Context, chans []<-chan struct{}) bool {
+	cases := make([]reflect.SelectCase, 0, len(chans)+1)
+	cases = append(cases, reflect.SelectCase{
+		Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done()),
+	})
+
+	for _, ch := range chans {
+		cases = append(cases, reflect.SelectCase{
+			Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch),
+		})
+	}
+
+	chosen, _, _ := reflect.Select(cases)
+
+	return chosen != 0
+}
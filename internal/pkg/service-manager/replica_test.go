@@ -0,0 +1,281 @@
+package servicemanager
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// replicaService is one replica of a Replicated service. It is
+// ready once ready is closed, fails once crash is, and is allowed
+// to fail so that Run outlives it.
+type replicaService struct {
+	Service
+	replicas int
+	quorum   int
+	ready    chan struct{}
+	crash    chan struct{}
+}
+
+func (r *replicaService) Run(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-r.crash:
+		return errTestService
+	}
+}
+
+func (r *replicaService) Replicas() int { return r.replicas }
+
+func (r *replicaService) Quorum() int { return r.quorum }
+
+func (r *replicaService) Ready() <-chan struct{} { return r.ready }
+
+func (r *replicaService) IsAllowedFailure() bool { return true }
+
+// registerReplicas registers worker with a factory that hands out
+// replicas in order, each reporting replicas and quorum, and
+// returns them.
+func registerReplicas(
+	sm *ServiceManager,
+	replicas int,
+	quorum int,
+) ([]*replicaService, *atomic.Int32) {
+	instances := make([]*replicaService, replicas)
+	for i := range instances {
+		instances[i] = &replicaService{
+			Service:  NewTestService("worker"),
+			replicas: replicas,
+			quorum:   quorum,
+			ready:    make(chan struct{}),
+			crash:    make(chan struct{}),
+		}
+	}
+
+	var calls atomic.Int32
+
+	sm.Register("worker", func() (Service, error) {
+		return instances[calls.Add(1)-1], nil
+	})
+
+	return instances, &calls
+}
+
+func statusNames(sm *ServiceManager) []string {
+	var names []string
+
+	for _, status := range sm.Status() {
+		names = append(names, status.Name)
+	}
+
+	return names
+}
+
+// waitForReplicasUp blocks until dependents can rely on every one
+// of names.
+func waitForReplicasUp(t *testing.T, sm *ServiceManager, names ...string) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		sm.runsMu.Lock()
+		defer sm.runsMu.Unlock()
+
+		for _, name := range names {
+			run, ok := sm.runs[name]
+			if !ok || !run.avail.state().up {
+				return false
+			}
+		}
+
+		return true
+	}, runHangGuard, startedPollInterval, "replicas never all up")
+}
+
+func TestServiceManager_Replicas(t *testing.T) {
+	testCases := []struct {
+		name      string
+		env       string
+		wantNames []string
+	}{
+		{
+			name:      "from the service",
+			wantNames: []string{"worker#0", "worker#1", "worker#2"},
+		},
+		{
+			name:      "from env",
+			env:       "worker=2",
+			wantNames: []string{"worker#0", "worker#1"},
+		},
+		{
+			name:      "single instance",
+			env:       "other=4, worker=1",
+			wantNames: []string{"worker"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("SERVICES_REPLICAS", tc.env)
+
+			ResetInstance()
+
+			sm := GetInstance()
+
+			instances, calls := registerReplicas(sm, 3, 0)
+			for _, instance := range instances {
+				close(instance.ready)
+			}
+
+			runDone, cancel := runInBackground(t, sm)
+
+			for _, name := range tc.wantNames {
+				waitForState(t, sm, name, StateReady)
+			}
+
+			assert.Equal(t, tc.wantNames, statusNames(sm))
+			assert.Equal(t, int32(len(tc.wantNames)), calls.Load())
+
+			cancel()
+			require.NoError(t, waitForRun(t, runDone))
+		})
+	}
+}
+
+func TestServiceManager_InvalidReplicaConfig(t *testing.T) {
+	testCases := []struct {
+		name string
+		env  string
+		val  string
+	}{
+		{name: "zero replicas", env: "SERVICES_REPLICAS", val: "worker=0"},
+		{name: "no count", env: "SERVICES_REPLICAS", val: "worker"},
+		{name: "no name", env: "SERVICES_REPLICAS", val: "=2"},
+		{name: "bad quorum", env: "SERVICES_QUORUM", val: "worker=x"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(tc.env, tc.val)
+
+			ResetInstance()
+
+			sm := GetInstance()
+			registerReplicas(sm, 2, 0)
+
+			require.ErrorIs(t, sm.Run(t.Context()), ErrInvalidConfig)
+		})
+	}
+}
+
+func TestServiceManager_ReplicaQuorumGatesDependents(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	instances, _ := registerReplicas(sm, 3, 2)
+	api := newLossRecordingService("api", "", "worker")
+	sm.Add(api)
+
+	runDone, cancel := runInBackground(t, sm)
+
+	close(instances[0].ready)
+	waitForState(t, sm, "worker#0", StateReady)
+
+	time.Sleep(noRunReturn)
+	assert.Zero(t, api.runs.Load(), "api started below quorum")
+
+	close(instances[2].ready)
+
+	require.Eventually(t, func() bool {
+		return api.runs.Load() == 1
+	}, runHangGuard, startedPollInterval)
+
+	status := waitForState(t, sm, "api", StateRunning)
+	assert.Equal(t, 1, status.Group)
+
+	cancel()
+	require.NoError(t, waitForRun(t, runDone))
+}
+
+func TestServiceManager_ReplicaQuorumLoss(t *testing.T) {
+	// The env quorum takes precedence over the service's.
+	t.Setenv("SERVICES_QUORUM", "worker=2")
+
+	ResetInstance()
+
+	sm := GetInstance()
+
+	instances, _ := registerReplicas(sm, 3, 3)
+	for _, instance := range instances {
+		close(instance.ready)
+	}
+
+	api := newLossRecordingService("api", "", "worker")
+	sm.Add(api)
+
+	runDone, cancel := runInBackground(t, sm)
+
+	waitForState(t, sm, "api", StateRunning)
+	waitForReplicasUp(t, sm, "worker#0", "worker#1", "worker#2")
+
+	close(instances[0].crash)
+	waitForState(t, sm, "worker#0", StateAllowedFailed)
+
+	time.Sleep(noRunReturn)
+	require.NoError(t, api.firstCause(), "one lost replica cancelled api")
+
+	close(instances[1].crash)
+
+	require.Eventually(t, func() bool {
+		return api.firstCause() != nil
+	}, runHangGuard, startedPollInterval)
+
+	var lost *DependencyLostError
+	require.ErrorAs(t, api.firstCause(), &lost)
+	assert.Equal(t, "worker", lost.Dependency)
+	require.ErrorIs(t, lost, errTestService)
+
+	// The quorum cannot be met again, so api fails for good.
+	require.ErrorIs(t, waitForRun(t, runDone), ErrDependencyLost)
+	cancel()
+}
+
+func TestServiceManager_ReplicaQuorumSurvivesClearServices(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	instances, _ := registerReplicas(sm, 3, 2)
+	for _, instance := range instances {
+		close(instance.ready)
+	}
+
+	api := newLossRecordingService("api", "", "worker")
+	sm.Add(api)
+
+	runDone, cancel := runInBackground(t, sm)
+	defer cancel()
+
+	waitForState(t, sm, "api", StateRunning)
+
+	// The live graph keeps its quorums, so api, gated on worker
+	// again after the restart, still needs only two replicas.
+	sm.ClearServices()
+	require.NoError(t, sm.RestartService(t.Context(), "api"))
+	waitForState(t, sm, "api", StateRunning)
+	waitForReplicasUp(t, sm, "worker#0", "worker#1", "worker#2")
+
+	close(instances[0].crash)
+	waitForState(t, sm, "worker#0", StateAllowedFailed)
+
+	time.Sleep(noRunReturn)
+	waitForState(t, sm, "api", StateRunning)
+
+	cancel()
+	require.NoError(t, waitForRun(t, runDone))
+}
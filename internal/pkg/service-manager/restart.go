@@ -0,0 +1,173 @@
+package servicemanager
+
+import (
+	"sync"
+	"time"
+)
+
+// RestartPolicy decides whether Run is called again after it
+// returns while the manager is still running.
+type RestartPolicy string
+
+const (
+	// RestartOnFailure retries a failed Run within the Retryable
+	// budget and leaves a clean exit alone. It is the default.
+	RestartOnFailure RestartPolicy = "on-failure"
+	// RestartAlways calls Run again after every return, clean or
+	// not, without limit. Retryable only supplies the delay.
+	RestartAlways RestartPolicy = "always"
+	// RestartNever runs Run once, even when the service is
+	// Retryable.
+	RestartNever RestartPolicy = "never"
+)
+
+// UnlimitedRetries is a MaxRetries value that retries failures
+// without limit.
+const UnlimitedRetries = -1
+
+// restartPlan is how one run of a service is restarted.
+type restartPlan struct {
+	policy     RestartPolicy
+	maxRetries int
+	backoff    Backoff
+	stableFor  time.Duration
+	classifier RetryClassifier
+}
+
+func restartPlanFor(service Service) restartPlan {
+	plan := restartPlan{
+		policy:  RestartOnFailure,
+		backoff: retryBackoff(service),
+	}
+
+	if r, ok := service.(Retryable); ok {
+		plan.maxRetries = r.MaxRetries()
+	}
+
+	if r, ok := service.(Restarter); ok && r.RestartPolicy() != "" {
+		plan.policy = r.RestartPolicy()
+	}
+
+	if st, ok := service.(Stabilizer); ok {
+		plan.stableFor = st.StabilityWindow()
+	}
+
+	if rc, ok := service.(RetryClassifier); ok {
+		plan.classifier = rc
+	}
+
+	return plan
+}
+
+// restarts reports whether Run is called again after attempt
+// returned err.
+func (p restartPlan) restarts(attempt int, err error) bool {
+	if err != nil && !p.retriable(err) {
+		return false
+	}
+
+	switch p.policy {
+	case RestartAlways:
+		return true
+	case RestartNever:
+		return false
+	case RestartOnFailure:
+	}
+
+	return err != nil && (p.maxRetries < 0 || attempt <= p.maxRetries)
+}
+
+// retriable reports whether a failure is worth another attempt.
+func (p restartPlan) retriable(err error) bool {
+	if IsPermanent(err) {
+		return false
+	}
+
+	return p.classifier == nil || p.classifier.ShouldRetry(err)
+}
+
+// exhausted reports whether a run that ended with err, and is not
+// restarted, used up its retries rather than being refused them.
+func (p restartPlan) exhausted(err error) bool {
+	return err != nil && p.policy == RestartOnFailure &&
+		p.maxRetries > 0 && p.retriable(err)
+}
+
+// retryBudget is how many times a failure is retried, whatever the
+// policy: RestartAlways retries without limit, RestartNever never.
+func (p restartPlan) retryBudget() int {
+	switch p.policy {
+	case RestartAlways:
+		return UnlimitedRetries
+	case RestartNever:
+		return 0
+	case RestartOnFailure:
+	}
+
+	if p.maxRetries < 0 {
+		return UnlimitedRetries
+	}
+
+	return p.maxRetries
+}
+
+// stable reports whether an attempt that ran for uptime earns a
+// fresh attempt count.
+func (p restartPlan) stable(uptime time.Duration) bool {
+	return p.stableFor > 0 && uptime >= p.stableFor
+}
+
+// restartIntensity is the manager-wide restart budget: more than
+// max automatic restarts, across all services, within window ends
+// Run. A non-positive max disables it.
+type restartIntensity struct {
+	mu     sync.Mutex
+	max    int
+	window time.Duration
+	times  []time.Time
+}
+
+func (r *restartIntensity) reset(maxRestarts int, window time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if window <= 0 {
+		window = defaultRestartWindow
+	}
+
+	r.max = maxRestarts
+	r.window = window
+	r.times = nil
+}
+
+// allow records a restart at now and reports whether the restarts
+// within the window still fit the budget.
+func (r *restartIntensity) allow(now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.max <= 0 {
+		return true
+	}
+
+	cutoff := now.Add(-r.window)
+
+	kept := r.times[:0]
+
+	for _, t := range r.times {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+
+	r.times = append(kept, now)
+
+	return len(r.times) <= r.max
+}
+
+func (r *restartIntensity) limits() (int, time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.max, r.window
+}
@@ -0,0 +1,398 @@
+package servicemanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptStep is one scripted Run: it waits for delay, then
+// returns err.
+type scriptStep struct {
+	delay time.Duration
+	err   error
+}
+
+// scriptedService plays its steps in order, one per Run call, and
+// runs until cancelled once they are used up.
+type scriptedService struct {
+	name       string
+	steps      []scriptStep
+	runs       atomic.Int32
+	policy     RestartPolicy
+	maxRetries int
+	stableFor  time.Duration
+}
+
+func (s *scriptedService) Name() string { return s.name }
+
+func (s *scriptedService) Run(ctx context.Context) error {
+	n := int(s.runs.Add(1))
+	if n > len(s.steps) {
+		<-ctx.Done()
+
+		return nil
+	}
+
+	step := s.steps[n-1]
+
+	select {
+	case <-time.After(step.delay):
+		return step.err
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+func (s *scriptedService) Stop(context.Context) error { return nil }
+
+func (s *scriptedService) MaxRetries() int { return s.maxRetries }
+
+func (s *scriptedService) RetryDelay() time.Duration { return 0 }
+
+func (s *scriptedService) RestartPolicy() RestartPolicy { return s.policy }
+
+func (s *scriptedService) StabilityWindow() time.Duration {
+	return s.stableFor
+}
+
+func TestServiceManager_RestartAlways(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	svc := &scriptedService{
+		name:   "daemon",
+		policy: RestartAlways,
+		steps:  []scriptStep{{}, {err: errTestService}, {}},
+	}
+
+	sm.Add(svc)
+
+	runDone, cancel := runInBackground(t, sm)
+
+	require.Eventually(t, func() bool {
+		return svc.runs.Load() == 4
+	}, runHangGuard, startedPollInterval)
+
+	status := waitForState(t, sm, "daemon", StateRunning)
+	assert.Equal(t, 4, status.Attempt)
+	assert.Equal(t, 3, status.Restarts)
+	require.ErrorIs(t, status.LastError, errTestService)
+
+	cancel()
+	require.NoError(t, waitForRun(t, runDone))
+}
+
+// returningDaemon returns from Run at once, is always restarted and
+// sets no delay of its own.
+type returningDaemon struct {
+	Service
+	runs atomic.Int32
+}
+
+func (d *returningDaemon) Run(context.Context) error {
+	d.runs.Add(1)
+
+	return nil
+}
+
+func (d *returningDaemon) RestartPolicy() RestartPolicy {
+	return RestartAlways
+}
+
+func TestServiceManager_RestartAlwaysBacksOff(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	svc := &returningDaemon{Service: NewTestService("daemon")}
+	sm.Add(svc)
+
+	runDone, cancel := runInBackground(t, sm)
+
+	require.Eventually(t, func() bool {
+		return svc.runs.Load() >= 2
+	}, runHangGuard, startedPollInterval)
+
+	time.Sleep(200 * time.Millisecond)
+
+	cancel()
+	require.NoError(t, waitForRun(t, runDone))
+
+	// The restarts come 100ms, 200ms and 400ms apart at the least.
+	assert.LessOrEqual(t, svc.runs.Load(), int32(4))
+}
+
+func TestServiceManager_RestartNever(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	svc := &scriptedService{
+		name:       "once",
+		policy:     RestartNever,
+		maxRetries: 3,
+		steps:      []scriptStep{{err: errTestService}},
+	}
+
+	sm.Add(svc)
+
+	runDone, cancel := runInBackground(t, sm)
+	defer cancel()
+
+	require.ErrorIs(t, waitForRun(t, runDone), errTestService)
+
+	assert.Equal(t, int32(1), svc.runs.Load())
+}
+
+func TestServiceManager_UnlimitedRetries(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	steps := make([]scriptStep, 10)
+	for i := range steps {
+		steps[i] = scriptStep{err: errTestService}
+	}
+
+	svc := &scriptedService{
+		name:       "stubborn",
+		maxRetries: UnlimitedRetries,
+		steps:      steps,
+	}
+
+	sm.Add(svc)
+
+	runDone, cancel := runInBackground(t, sm)
+
+	// Every failed attempt passes through running too, so only the
+	// eleventh Run call tells the retries are over.
+	require.Eventually(t, func() bool {
+		return svc.runs.Load() == 11
+	}, runHangGuard, startedPollInterval)
+
+	status := waitForState(t, sm, "stubborn", StateRunning)
+	assert.Equal(t, 11, status.Attempt)
+
+	cancel()
+	require.NoError(t, waitForRun(t, runDone))
+}
+
+func TestServiceManager_StabilityWindowResetsAttempts(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	// With one retry, the second failure would be terminal; but the
+	// second attempt outlives the window, so its failure counts as a
+	// first attempt again and earns another retry.
+	svc := &scriptedService{
+		name:       "daily",
+		maxRetries: 1,
+		stableFor:  20 * time.Millisecond,
+		steps: []scriptStep{
+			{err: errTestService},
+			{delay: 40 * time.Millisecond, err: errTestService},
+		},
+	}
+
+	sm.Add(svc)
+
+	runDone, cancel := runInBackground(t, sm)
+
+	require.Eventually(t, func() bool {
+		return svc.runs.Load() == 3
+	}, runHangGuard, startedPollInterval)
+
+	status := waitForState(t, sm, "daily", StateRunning)
+	assert.Equal(t, 2, status.Attempt)
+	assert.Equal(t, 2, status.Restarts)
+
+	cancel()
+	require.NoError(t, waitForRun(t, runDone))
+}
+
+// retryOnlyClassifier treats target as the only transient error.
+type retryOnlyClassifier struct {
+	target error
+}
+
+func retryOnly(target error) retryOnlyClassifier {
+	return retryOnlyClassifier{target: target}
+}
+
+func (r retryOnlyClassifier) ShouldRetry(err error) bool {
+	return errors.Is(err, r.target)
+}
+
+func TestServiceManager_PermanentErrorSkipsRetries(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	svc := NewRetryableMockService("config", 3).
+		WithRetryDelay(time.Hour)
+	svc.WithRunError(fmt.Errorf("parse: %w", Permanent(errTestService)))
+
+	sm.Add(svc)
+
+	runDone, cancel := runInBackground(t, sm)
+	defer cancel()
+
+	require.ErrorIs(t, waitForRun(t, runDone), errTestService)
+
+	assert.Equal(t, 1, svc.RunCount())
+}
+
+func TestRestartPlan_Restarts(t *testing.T) {
+	testCases := []struct {
+		name    string
+		plan    restartPlan
+		attempt int
+		err     error
+		want    bool
+	}{
+		{"on-failure within budget", restartPlan{
+			policy: RestartOnFailure, maxRetries: 2,
+		}, 2, errTestService, true},
+		{"on-failure out of budget", restartPlan{
+			policy: RestartOnFailure, maxRetries: 2,
+		}, 3, errTestService, false},
+		{"on-failure clean exit", restartPlan{
+			policy: RestartOnFailure, maxRetries: 2,
+		}, 1, nil, false},
+		{"on-failure unlimited", restartPlan{
+			policy: RestartOnFailure, maxRetries: UnlimitedRetries,
+		}, 1000, errTestService, true},
+		{"always clean exit", restartPlan{
+			policy: RestartAlways,
+		}, 1000, nil, true},
+		{"never", restartPlan{
+			policy: RestartNever, maxRetries: 5,
+		}, 1, errTestService, false},
+		{"permanent error", restartPlan{
+			policy: RestartAlways,
+		}, 1, Permanent(errTestService), false},
+		{"classified transient", restartPlan{
+			policy: RestartOnFailure, maxRetries: 2,
+			classifier: retryOnly(errTestService),
+		}, 1, errTestService, true},
+		{"classified unrecoverable", restartPlan{
+			policy: RestartOnFailure, maxRetries: 2,
+			classifier: retryOnly(errTestService),
+		}, 1, errTestDifferent, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.plan.restarts(tc.attempt, tc.err))
+		})
+	}
+}
+
+func TestRestartIntensity_Allow(t *testing.T) {
+	var intensity restartIntensity
+
+	intensity.reset(2, time.Minute)
+
+	start := time.Now()
+
+	assert.True(t, intensity.allow(start))
+	assert.True(t, intensity.allow(start.Add(time.Second)))
+	assert.False(t, intensity.allow(start.Add(2*time.Second)))
+	assert.True(t, intensity.allow(start.Add(70*time.Second)))
+
+	intensity.reset(0, 0)
+
+	for range 100 {
+		assert.True(t, intensity.allow(start))
+	}
+
+	maxRestarts, window := intensity.limits()
+	assert.Zero(t, maxRestarts)
+	assert.Equal(t, defaultRestartWindow, window)
+}
+
+func TestServiceManager_RestartIntensity(t *testing.T) {
+	t.Setenv("SERVICEMANAGER_MAXRESTARTS", "5")
+	t.Setenv("SERVICEMANAGER_RESTARTWINDOW", "1m")
+
+	ResetInstance()
+
+	sm := GetInstance()
+
+	// Each is allowed to fail and retries forever; only the
+	// manager-wide limit can end Run.
+	for _, name := range []string{"cache", "queue"} {
+		svc := NewFullMockService(name).
+			WithMaxRetries(UnlimitedRetries).
+			WithAllowFailure(true)
+		svc.WithRunError(errTestService)
+
+		sm.Add(svc)
+	}
+
+	runDone, cancel := runInBackground(t, sm)
+	defer cancel()
+
+	err := waitForRun(t, runDone)
+	require.ErrorIs(t, err, ErrRestartIntensity)
+	require.ErrorIs(t, err, errTestService)
+
+	failed := 0
+
+	for _, status := range sm.Status() {
+		if status.State == StateFailed {
+			failed++
+		}
+	}
+
+	assert.GreaterOrEqual(t, failed, 1)
+}
+
+// retryingExitCodingService retries forever and maps errTestService
+// to testExitCode.
+type retryingExitCodingService struct {
+	*RetryableMockService
+}
+
+func (r *retryingExitCodingService) ExitCode(err error) int {
+	if errors.Is(err, errTestService) {
+		return testExitCode
+	}
+
+	return 0
+}
+
+func TestServiceManager_RestartIntensityExitCode(t *testing.T) {
+	t.Setenv("SERVICEMANAGER_MAXRESTARTS", "2")
+
+	ResetInstance()
+
+	sm := GetInstance()
+
+	svc := &retryingExitCodingService{
+		RetryableMockService: NewRetryableMockService(
+			"fail", UnlimitedRetries,
+		),
+	}
+	svc.WithRunError(errTestService)
+	sm.Add(svc)
+
+	runDone, cancel := runInBackground(t, sm)
+	defer cancel()
+
+	err := waitForRun(t, runDone)
+	require.ErrorIs(t, err, ErrRestartIntensity)
+
+	var serviceErr *ServiceError
+	require.ErrorAs(t, err, &serviceErr)
+	assert.Equal(t, testExitCode, serviceErr.ExitCode)
+}
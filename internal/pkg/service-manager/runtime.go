@@ -0,0 +1,113 @@
+package servicemanager
+
+import (
+	"context"
+	"time"
+)
+
+// RestartReason says why Run is called again.
+type RestartReason string
+
+const (
+	// RestartReasonNone marks the first Run call of a service.
+	RestartReasonNone RestartReason = ""
+	// RestartReasonFailure follows an attempt that failed.
+	RestartReasonFailure RestartReason = "failure"
+	// RestartReasonExit follows a clean exit under RestartAlways.
+	RestartReasonExit RestartReason = "exit"
+	// RestartReasonDependencyLost follows an attempt that a lost
+	// dependency ended, once the dependency is ready again.
+	RestartReasonDependencyLost RestartReason = "dependency-lost"
+	// RestartReasonStrategy marks a fresh instance that the
+	// supervision strategy restarted along with another service.
+	RestartReasonStrategy RestartReason = "strategy"
+	// RestartReasonControl marks a fresh instance started through
+	// the control API.
+	RestartReasonControl RestartReason = "control"
+)
+
+// RuntimeInfo describes the Run call in progress. The manager puts
+// it in the context passed to Run, so a service can tell a retry
+// from a first start without keeping count itself.
+type RuntimeInfo struct {
+	// Service is the name of the service.
+	Service string
+	// Attempt counts Run calls from 1. A fresh instance restarted
+	// by the supervision strategy carries on its predecessor's
+	// count, and a stable attempt starts it over.
+	Attempt int
+	// MaxRetries is how many times a failure is retried:
+	// UnlimitedRetries without limit, 0 not at all.
+	MaxRetries int
+	// PrevErr is the error the previous attempt ended with. It is
+	// nil on a first start and after a clean exit.
+	PrevErr error
+	// RestartReason says why Run is called again.
+	RestartReason RestartReason
+	// ScheduledAt is when the scheduled run in progress was due.
+	// It is zero unless the service is Scheduled.
+	ScheduledAt time.Time
+}
+
+// resumption is what a fresh instance takes over from the run it
+// replaces: the attempts made so far and why Run is called again.
+type resumption struct {
+	attempts int
+	reason   RestartReason
+	err      error
+}
+
+type runtimeInfoKey struct{}
+
+func withRuntimeInfo(ctx context.Context, info RuntimeInfo) context.Context {
+	return context.WithValue(ctx, runtimeInfoKey{}, info)
+}
+
+// RuntimeInfoFromContext returns the RuntimeInfo of the Run call
+// ctx was passed to, and false outside of one.
+func RuntimeInfoFromContext(ctx context.Context) (RuntimeInfo, bool) {
+	info, ok := ctx.Value(runtimeInfoKey{}).(RuntimeInfo)
+
+	return info, ok
+}
+
+// ServiceNameFromContext returns the name of the service whose Run
+// ctx was passed to, or "" outside of one.
+func ServiceNameFromContext(ctx context.Context) string {
+	info, _ := RuntimeInfoFromContext(ctx)
+
+	return info.Service
+}
+
+// AttemptFromContext returns the attempt of the Run call ctx was
+// passed to, or 0 outside of one.
+func AttemptFromContext(ctx context.Context) int {
+	info, _ := RuntimeInfoFromContext(ctx)
+
+	return info.Attempt
+}
+
+// MaxRetriesFromContext returns the retry budget of the service
+// whose Run ctx was passed to, or 0 outside of one.
+func MaxRetriesFromContext(ctx context.Context) int {
+	info, _ := RuntimeInfoFromContext(ctx)
+
+	return info.MaxRetries
+}
+
+// PrevErrFromContext returns the error the attempt before the Run
+// call ctx was passed to ended with, or nil.
+func PrevErrFromContext(ctx context.Context) error {
+	info, _ := RuntimeInfoFromContext(ctx)
+
+	return info.PrevErr
+}
+
+// RestartReasonFromContext returns why the Run call ctx was passed
+// to was made, or RestartReasonNone on a first start and outside of
+// one.
+func RestartReasonFromContext(ctx context.Context) RestartReason {
+	info, _ := RuntimeInfoFromContext(ctx)
+
+	return info.RestartReason
+}
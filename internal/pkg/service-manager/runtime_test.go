@@ -0,0 +1,214 @@
+package servicemanager
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// infoRecorder collects the RuntimeInfo of every Run call of the
+// instances sharing it.
+type infoRecorder struct {
+	mu    sync.Mutex
+	infos []RuntimeInfo
+}
+
+func (r *infoRecorder) record(ctx context.Context) int {
+	info, _ := RuntimeInfoFromContext(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.infos = append(r.infos, info)
+
+	return len(r.infos)
+}
+
+func (r *infoRecorder) snapshot() []RuntimeInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]RuntimeInfo(nil), r.infos...)
+}
+
+func (r *infoRecorder) waitFor(t *testing.T, calls int) []RuntimeInfo {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		return len(r.snapshot()) >= calls
+	}, runHangGuard, startedPollInterval,
+		"Run was never called %d time(s)", calls)
+
+	return r.snapshot()
+}
+
+// infoRecordingService records its RuntimeInfo on every Run call.
+// Call n returns results[n-1], and runs until cancelled past them.
+type infoRecordingService struct {
+	Service
+	recorder *infoRecorder
+	results  []error
+	policy   RestartPolicy
+	deps     []string
+}
+
+func (s *infoRecordingService) Run(ctx context.Context) error {
+	if n := s.recorder.record(ctx); n <= len(s.results) {
+		return s.results[n-1]
+	}
+
+	<-ctx.Done()
+
+	return nil
+}
+
+func (s *infoRecordingService) MaxRetries() int { return 3 }
+
+func (s *infoRecordingService) RetryDelay() time.Duration { return 0 }
+
+func (s *infoRecordingService) RestartPolicy() RestartPolicy {
+	return s.policy
+}
+
+func (s *infoRecordingService) Dependencies() []string { return s.deps }
+
+func TestServiceManager_RuntimeInfo(t *testing.T) {
+	testCases := []struct {
+		name       string
+		results    []error
+		policy     RestartPolicy
+		maxRetries int
+		reason     RestartReason
+		prevErr    error
+	}{
+		{
+			name:       "retried after failure",
+			results:    []error{errTestService, errTestService},
+			maxRetries: 3,
+			reason:     RestartReasonFailure,
+			prevErr:    errTestService,
+		},
+		{
+			name:       "restarted after exit",
+			results:    []error{nil, nil},
+			policy:     RestartAlways,
+			maxRetries: UnlimitedRetries,
+			reason:     RestartReasonExit,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ResetInstance()
+
+			sm := GetInstance()
+			recorder := &infoRecorder{}
+			sm.Add(&infoRecordingService{
+				Service:  NewTestService("svc"),
+				recorder: recorder,
+				results:  tc.results,
+				policy:   tc.policy,
+			})
+
+			stop := runControlled(t, sm, 1)
+			defer stop()
+
+			infos := recorder.waitFor(t, 3)
+
+			assert.Equal(t, RuntimeInfo{
+				Service:    "svc",
+				Attempt:    1,
+				MaxRetries: tc.maxRetries,
+			}, infos[0])
+
+			for i, info := range infos[1:3] {
+				assert.Equal(t, "svc", info.Service)
+				assert.Equal(t, i+2, info.Attempt)
+				assert.Equal(t, tc.maxRetries, info.MaxRetries)
+				assert.Equal(t, tc.reason, info.RestartReason)
+				assert.Equal(t, tc.prevErr, info.PrevErr)
+			}
+		})
+	}
+}
+
+func TestServiceManager_RuntimeInfoDependencyLost(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	crash := make(chan struct{})
+	recorder := &infoRecorder{}
+	sm.Add(
+		&crashingService{Service: NewTestService("db"), crash: crash},
+		&infoRecordingService{
+			Service:  NewTestService("api"),
+			recorder: recorder,
+			deps:     []string{"db"},
+		},
+	)
+
+	stop := runControlled(t, sm, 2)
+	defer stop()
+
+	recorder.waitFor(t, 1)
+	close(crash)
+
+	info := recorder.waitFor(t, 2)[1]
+	assert.Equal(t, 1, info.Attempt)
+	assert.Equal(t, RestartReasonDependencyLost, info.RestartReason)
+	require.ErrorIs(t, info.PrevErr, ErrDependencyLost)
+}
+
+func TestServiceManager_RuntimeInfoFreshInstances(t *testing.T) {
+	t.Setenv("SERVICEMANAGER_STRATEGY", string(OneForAll))
+
+	ResetInstance()
+
+	sm := GetInstance()
+
+	crash := make(chan struct{})
+	sm.Add(&crashingService{Service: NewTestService("db"), crash: crash})
+
+	recorder := &infoRecorder{}
+	sm.Register("cache", func() (Service, error) {
+		return &infoRecordingService{
+			Service:  NewTestService("cache"),
+			recorder: recorder,
+		}, nil
+	})
+
+	stop := runControlled(t, sm, 2)
+	defer stop()
+
+	recorder.waitFor(t, 1)
+	close(crash)
+
+	info := recorder.waitFor(t, 2)[1]
+	assert.Equal(t, 1, info.Attempt)
+	assert.Equal(t, RestartReasonStrategy, info.RestartReason)
+	require.NoError(t, info.PrevErr)
+
+	waitForState(t, sm, "cache", StateRunning)
+	require.NoError(t, sm.RestartService(t.Context(), "cache"))
+
+	info = recorder.waitFor(t, 3)[2]
+	assert.Equal(t, 1, info.Attempt)
+	assert.Equal(t, RestartReasonControl, info.RestartReason)
+}
+
+func TestRuntimeInfoFromContext_OutsideRun(t *testing.T) {
+	ctx := t.Context()
+
+	_, ok := RuntimeInfoFromContext(ctx)
+	assert.False(t, ok)
+	assert.Empty(t, ServiceNameFromContext(ctx))
+	assert.Zero(t, AttemptFromContext(ctx))
+	assert.Zero(t, MaxRetriesFromContext(ctx))
+	require.NoError(t, PrevErrFromContext(ctx))
+	assert.Equal(t, RestartReasonNone, RestartReasonFromContext(ctx))
+}
@@ -0,0 +1,344 @@
+package servicemanager
+
+import (
+	"context"
+	"time"
+
+	"github.com/psyb0t/ctxerrors"
+	"github.com/psyb0t/ctxscope"
+)
+
+// OverlapPolicy decides what happens when a scheduled run is due
+// while the previous one still runs.
+type OverlapPolicy string
+
+const (
+	// OverlapSkip drops the run that is due. It is the default.
+	OverlapSkip OverlapPolicy = "skip"
+	// OverlapQueue starts the run that is due as soon as the
+	// previous one returns. At most one run waits; runs due while
+	// one already does are dropped.
+	OverlapQueue OverlapPolicy = "queue"
+	// OverlapCancelPrevious cancels the previous run, with
+	// ErrSuperseded as the cause, and starts the one that is due
+	// once it has returned.
+	OverlapCancelPrevious OverlapPolicy = "cancel-previous"
+)
+
+func (p OverlapPolicy) valid() bool {
+	switch p {
+	case OverlapSkip, OverlapQueue, OverlapCancelPrevious:
+		return true
+	}
+
+	return false
+}
+
+// Schedule says when a Scheduled service runs. Cron takes
+// precedence over Every; one of them is required.
+type Schedule struct {
+	// Cron is a five-field cron expression, minute hour
+	// day-of-month month day-of-week, or a descriptor such as
+	// @hourly or @daily.
+	Cron string
+	// Every runs the service at a fixed interval, the first time
+	// one interval after it starts.
+	Every time.Duration
+	// Location is the time zone Cron is read in; nil means
+	// time.Local.
+	Location *time.Location
+	// Overlap is what happens to a run that is due while the
+	// previous one still runs; empty means OverlapSkip.
+	Overlap OverlapPolicy
+	// Jitter delays every run by a random duration below it, so
+	// instances sharing a schedule spread out.
+	Jitter time.Duration
+}
+
+// Execution is the outcome of one scheduled run of a service.
+type Execution struct {
+	// ScheduledAt is when the run was due, before jitter.
+	ScheduledAt time.Time
+	// StartedAt is when its first Run call began.
+	StartedAt time.Time
+	// Duration is how long the run took, retries included.
+	Duration time.Duration
+	// Attempts counts its Run calls.
+	Attempts int
+	// Err is the error of its last Run call.
+	Err error
+}
+
+// schedule is a Schedule checked and ready to follow.
+type schedule struct {
+	Schedule
+
+	cron *cronSpec
+}
+
+func newSchedule(sc Schedule) (schedule, error) {
+	if sc.Overlap == "" {
+		sc.Overlap = OverlapSkip
+	}
+
+	if !sc.Overlap.valid() {
+		return schedule{}, ctxerrors.Wrapf(
+			ErrInvalidSchedule, "unknown overlap policy %q", sc.Overlap,
+		)
+	}
+
+	if sc.Jitter < 0 {
+		return schedule{}, ctxerrors.Wrapf(
+			ErrInvalidSchedule, "negative jitter %s", sc.Jitter,
+		)
+	}
+
+	if sc.Location == nil {
+		sc.Location = time.Local
+	}
+
+	if sc.Cron == "" {
+		if sc.Every <= 0 {
+			return schedule{}, ctxerrors.Wrap(
+				ErrInvalidSchedule, "neither Cron nor a positive Every",
+			)
+		}
+
+		return schedule{Schedule: sc}, nil
+	}
+
+	cron, err := parseCron(sc.Cron, sc.Location)
+	if err != nil {
+		return schedule{}, err
+	}
+
+	return schedule{Schedule: sc, cron: cron}, nil
+}
+
+// next returns when the run after the one due at prev is due. Runs
+// that would already be due by now are missed, not caught up on.
+func (sc schedule) next(prev time.Time, now time.Time) time.Time {
+	if sc.cron == nil {
+		next := prev.Add(sc.Every)
+		if next.Before(now) {
+			next = now.Add(sc.Every - now.Sub(prev)%sc.Every)
+		}
+
+		return next
+	}
+
+	if prev.Before(now) {
+		prev = now
+	}
+
+	return sc.cron.next(prev)
+}
+
+// jitter is the random delay of one run.
+func (sc schedule) jitter() time.Duration {
+	if sc.Jitter <= 0 {
+		return 0
+	}
+
+	return randomDelay(sc.Jitter)
+}
+
+// execution is a scheduled run in progress.
+type execution struct {
+	done   chan struct{}
+	cancel context.CancelCauseFunc
+}
+
+// finished is closed once the run has returned. It is nil, and
+// never ready, without a run.
+func (e *execution) finished() <-chan struct{} {
+	if e == nil {
+		return nil
+	}
+
+	return e.done
+}
+
+// runSchedule calls Run of a Scheduled service every time its
+// schedule is due, until ctx is done, and waits for the run in
+// progress to return. It only fails, permanently, for a schedule
+// that cannot be followed.
+func (s *ServiceManager) runSchedule(
+	ctx context.Context,
+	run *serviceRun,
+	sc Scheduled,
+) error {
+	sched, err := newSchedule(sc.Schedule())
+	if err != nil {
+		return Permanent(err)
+	}
+
+	s.status.transition(run.name, StateScheduled)
+
+	var (
+		current *execution
+		queued  time.Time
+	)
+
+	defer func() {
+		if current != nil {
+			<-current.done
+		}
+	}()
+
+	due := time.Now()
+
+	for {
+		due = sched.next(due, time.Now())
+		if due.IsZero() {
+			return Permanent(ctxerrors.Wrapf(
+				ErrInvalidSchedule, "cron %q never fires", sched.Cron,
+			))
+		}
+
+		at := due.Add(sched.jitter())
+		s.status.scheduled(run.name, at)
+
+		ctxscope.GetLogger(ctx).Debug("next scheduled run", "at", at)
+
+		timer := time.NewTimer(time.Until(at))
+
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+
+				return nil
+			case <-current.finished():
+				current = nil
+
+				if !queued.IsZero() {
+					current = s.startExecution(ctx, run, queued)
+					queued = time.Time{}
+				}
+			case <-timer.C:
+				break wait
+			}
+		}
+
+		switch {
+		case current == nil:
+			current = s.startExecution(ctx, run, due)
+		case sched.Overlap == OverlapQueue && queued.IsZero():
+			queued = due
+		case sched.Overlap == OverlapCancelPrevious:
+			current.cancel(ErrSuperseded)
+			<-current.finished()
+
+			current = s.startExecution(ctx, run, due)
+		default:
+			ctxscope.GetLogger(ctx).Warn(
+				"skipping scheduled run, previous one still running",
+				"scheduled_at", due,
+			)
+			s.emit(Event{Type: EventExecutionSkipped, Service: run.name})
+		}
+	}
+}
+
+// startExecution runs the service for the run due at due on its
+// own goroutine.
+func (s *ServiceManager) startExecution(
+	ctx context.Context,
+	run *serviceRun,
+	due time.Time,
+) *execution {
+	execCtx, cancel := context.WithCancelCause(ctx)
+	e := &execution{done: make(chan struct{}), cancel: cancel}
+
+	s.wg.Go(func() {
+		defer close(e.done)
+		defer cancel(nil)
+
+		s.execute(execCtx, run, due)
+	})
+
+	return e
+}
+
+// execute makes one scheduled run: it calls Run, retries it as the
+// restart plan of the service says, and records the outcome. Its
+// retries count towards the restart intensity; one past the limit
+// fails the application instead.
+func (s *ServiceManager) execute(
+	ctx context.Context,
+	run *serviceRun,
+	due time.Time,
+) {
+	plan := restartPlanFor(run.service)
+	result := Execution{ScheduledAt: due, StartedAt: time.Now()}
+	info := RuntimeInfo{
+		Service:     run.name,
+		MaxRetries:  plan.retryBudget(),
+		ScheduledAt: due,
+	}
+
+	for attempt := 1; ; attempt++ {
+		s.status.attempt(run.name, attempt, StateRunning)
+		s.emit(Event{Type: EventStarted, Service: run.name, Attempt: attempt})
+
+		info.Attempt = attempt
+		result.Attempts = attempt
+		result.Err = s.safeRun(
+			withRuntimeInfo(ctx, info), run.name, run.service,
+		)
+
+		if result.Err == nil || ctx.Err() != nil ||
+			!plan.restarts(attempt, result.Err) {
+			break
+		}
+
+		if !s.intensity.allow(time.Now()) {
+			s.exceedRestartIntensity(ctx, run, attempt, result.Err)
+
+			return
+		}
+
+		s.status.retrying(run.name, result.Err)
+
+		if !s.waitRetryDelay(
+			ctx, run.name, plan.backoff,
+			attempt, plan.maxRetries, result.Err,
+		) {
+			break
+		}
+
+		info.PrevErr = result.Err
+		info.RestartReason = RestartReasonFailure
+	}
+
+	result.Duration = time.Since(result.StartedAt)
+
+	if result.Err != nil {
+		ctxscope.GetLogger(ctx).Warn("scheduled run failed",
+			"attempts", result.Attempts,
+			"duration", result.Duration,
+			"err", result.Err,
+		)
+	} else {
+		ctxscope.GetLogger(ctx).Info("scheduled run finished",
+			"attempts", result.Attempts,
+			"duration", result.Duration,
+		)
+	}
+
+	s.status.executed(run.name, result)
+	s.emit(Event{
+		Type:    EventExecuted,
+		Service: run.name,
+		Attempt: result.Attempts,
+		Err:     result.Err,
+	})
+}
+
+func isScheduled(service Service) bool {
+	_, ok := service.(Scheduled)
+
+	return ok
+}
@@ -0,0 +1,352 @@
+package servicemanager
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scheduledService is a Scheduled service whose Run call n returns
+// what run(ctx, n) does. It records the RuntimeInfo of every call.
+type scheduledService struct {
+	name       string
+	schedule   Schedule
+	maxRetries int
+	run        func(ctx context.Context, n int) error
+	runs       atomic.Int32
+	infoMu     sync.Mutex
+	infos      []RuntimeInfo
+}
+
+func (s *scheduledService) Name() string { return s.name }
+
+func (s *scheduledService) Run(ctx context.Context) error {
+	info, _ := RuntimeInfoFromContext(ctx)
+
+	s.infoMu.Lock()
+	s.infos = append(s.infos, info)
+	s.infoMu.Unlock()
+
+	return s.run(ctx, int(s.runs.Add(1)))
+}
+
+func (s *scheduledService) Stop(context.Context) error { return nil }
+
+func (s *scheduledService) Schedule() Schedule { return s.schedule }
+
+func (s *scheduledService) MaxRetries() int { return s.maxRetries }
+
+func (s *scheduledService) RetryDelay() time.Duration { return 0 }
+
+func (s *scheduledService) info(n int) RuntimeInfo {
+	s.infoMu.Lock()
+	defer s.infoMu.Unlock()
+
+	return s.infos[n-1]
+}
+
+// waitForEvents returns the first n events of type want.
+func waitForEvents(
+	t *testing.T,
+	events <-chan Event,
+	want EventType,
+	n int,
+) []Event {
+	t.Helper()
+
+	var got []Event
+
+	timeout := time.After(runHangGuard)
+
+	for len(got) < n {
+		select {
+		case event := <-events:
+			if event.Type == want {
+				got = append(got, event)
+			}
+		case <-timeout:
+			t.Fatalf("saw %d of %d %s events", len(got), n, want)
+		}
+	}
+
+	return got
+}
+
+func TestServiceManager_ScheduledRuns(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	svc := &scheduledService{
+		name:     "cleanup",
+		schedule: Schedule{Every: 10 * time.Millisecond},
+		run:      func(context.Context, int) error { return nil },
+	}
+	sm.Add(svc)
+
+	events, unsubscribe := sm.Subscribe(64)
+	defer unsubscribe()
+
+	runDone, cancel := runInBackground(t, sm)
+
+	for _, event := range waitForEvents(t, events, EventExecuted, 3) {
+		assert.Equal(t, 1, event.Attempt)
+		require.NoError(t, event.Err)
+	}
+
+	status := waitForState(t, sm, "cleanup", StateScheduled)
+	assert.Equal(t, 1, status.LastExecution.Attempts)
+	require.NoError(t, status.LastExecution.Err)
+	assert.False(t, status.NextRun.IsZero())
+	assert.Equal(t, HealthOK, status.Health.State)
+
+	first, second := svc.info(1), svc.info(2)
+	assert.Equal(t, "cleanup", first.Service)
+	assert.Equal(t, 1, first.Attempt)
+	// Runs stay on the interval grid, even after a missed one.
+	interval := second.ScheduledAt.Sub(first.ScheduledAt)
+	assert.Positive(t, interval)
+	assert.Zero(t, interval%(10*time.Millisecond))
+
+	cancel()
+	require.NoError(t, waitForRun(t, runDone))
+}
+
+func TestServiceManager_ScheduledRetries(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	svc := &scheduledService{
+		name:       "report",
+		schedule:   Schedule{Every: 10 * time.Millisecond},
+		maxRetries: 1,
+		run: func(_ context.Context, n int) error {
+			if n%2 == 1 {
+				return errTestService
+			}
+
+			return nil
+		},
+	}
+	sm.Add(svc)
+
+	events, unsubscribe := sm.Subscribe(64)
+	defer unsubscribe()
+
+	runDone, cancel := runInBackground(t, sm)
+
+	for _, event := range waitForEvents(t, events, EventExecuted, 2) {
+		assert.Equal(t, 2, event.Attempt)
+		require.NoError(t, event.Err)
+	}
+
+	retry := svc.info(2)
+	assert.Equal(t, 2, retry.Attempt)
+	assert.Equal(t, RestartReasonFailure, retry.RestartReason)
+	require.ErrorIs(t, retry.PrevErr, errTestService)
+	assert.Equal(t, svc.info(1).ScheduledAt, retry.ScheduledAt)
+
+	cancel()
+	require.NoError(t, waitForRun(t, runDone))
+}
+
+func TestServiceManager_ScheduledFailureKeepsSchedule(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	sm.Add(&scheduledService{
+		name:     "report",
+		schedule: Schedule{Every: 10 * time.Millisecond},
+		run:      func(context.Context, int) error { return errTestService },
+	})
+
+	events, unsubscribe := sm.Subscribe(64)
+	defer unsubscribe()
+
+	runDone, cancel := runInBackground(t, sm)
+
+	for _, event := range waitForEvents(t, events, EventExecuted, 2) {
+		require.ErrorIs(t, event.Err, errTestService)
+	}
+
+	report := waitForHealth(t, sm, HealthDegraded)
+	require.ErrorIs(t, report.Services[0].LastExecution.Err, errTestService)
+
+	select {
+	case err := <-runDone:
+		t.Fatalf("a failed run ended Run: %v", err)
+	default:
+	}
+
+	cancel()
+	require.NoError(t, waitForRun(t, runDone))
+}
+
+func TestServiceManager_ScheduledRestartIntensity(t *testing.T) {
+	t.Setenv("SERVICEMANAGER_MAXRESTARTS", "2")
+
+	ResetInstance()
+
+	sm := GetInstance()
+
+	sm.Add(&scheduledService{
+		name:       "report",
+		schedule:   Schedule{Every: 10 * time.Millisecond},
+		maxRetries: UnlimitedRetries,
+		run:        func(context.Context, int) error { return errTestService },
+	})
+
+	runDone, cancel := runInBackground(t, sm)
+	defer cancel()
+
+	err := waitForRun(t, runDone)
+	require.ErrorIs(t, err, ErrRestartIntensity)
+	require.ErrorIs(t, err, errTestService)
+
+	// The first run and its two allowed retries.
+	var serviceErr *ServiceError
+	require.ErrorAs(t, err, &serviceErr)
+	assert.Equal(t, "report", serviceErr.Service)
+	assert.Equal(t, 3, serviceErr.Attempts)
+}
+
+func TestServiceManager_ScheduleOverlap(t *testing.T) {
+	testCases := []struct {
+		name    string
+		overlap OverlapPolicy
+		// queued is whether the second run was due before the
+		// first one returned.
+		queued bool
+	}{
+		{name: "skip", overlap: OverlapSkip},
+		{name: "queue", overlap: OverlapQueue, queued: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ResetInstance()
+
+			sm := GetInstance()
+
+			release := make(chan struct{})
+			svc := &scheduledService{
+				name: "sync",
+				schedule: Schedule{
+					Every:   5 * time.Millisecond,
+					Overlap: tc.overlap,
+				},
+				run: func(_ context.Context, n int) error {
+					if n == 1 {
+						<-release
+					}
+
+					return nil
+				},
+			}
+			sm.Add(svc)
+
+			events, unsubscribe := sm.Subscribe(64)
+			defer unsubscribe()
+
+			runDone, cancel := runInBackground(t, sm)
+
+			waitForEvents(t, events, EventExecutionSkipped, 1)
+			assert.Equal(t, int32(1), svc.runs.Load())
+
+			releasedAt := time.Now()
+
+			close(release)
+			waitForEvents(t, events, EventExecuted, 2)
+
+			dueBefore := svc.info(2).ScheduledAt.Before(releasedAt)
+			assert.Equal(t, tc.queued, dueBefore)
+
+			cancel()
+			require.NoError(t, waitForRun(t, runDone))
+		})
+	}
+}
+
+func TestServiceManager_ScheduleCancelPrevious(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	causes := make(chan error, 1)
+	sm.Add(&scheduledService{
+		name: "sync",
+		schedule: Schedule{
+			Every:   10 * time.Millisecond,
+			Overlap: OverlapCancelPrevious,
+		},
+		run: func(ctx context.Context, n int) error {
+			if n == 1 {
+				<-ctx.Done()
+				causes <- context.Cause(ctx)
+			}
+
+			return nil
+		},
+	})
+
+	events, unsubscribe := sm.Subscribe(64)
+	defer unsubscribe()
+
+	runDone, cancel := runInBackground(t, sm)
+
+	waitForEvents(t, events, EventExecuted, 2)
+	require.ErrorIs(t, <-causes, ErrSuperseded)
+
+	cancel()
+	require.NoError(t, waitForRun(t, runDone))
+}
+
+func TestServiceManager_InvalidSchedule(t *testing.T) {
+	testCases := []struct {
+		name     string
+		schedule Schedule
+	}{
+		{name: "empty", schedule: Schedule{}},
+		{name: "bad cron", schedule: Schedule{Cron: "* * *"}},
+		{name: "never fires", schedule: Schedule{Cron: "0 0 30 2 *"}},
+		{
+			name: "unknown overlap",
+			schedule: Schedule{
+				Every:   time.Second,
+				Overlap: OverlapPolicy("pile-up"),
+			},
+		},
+		{
+			name:     "negative jitter",
+			schedule: Schedule{Every: time.Second, Jitter: -time.Second},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ResetInstance()
+
+			sm := GetInstance()
+
+			svc := &scheduledService{
+				name:     "cleanup",
+				schedule: tc.schedule,
+				run:      func(context.Context, int) error { return nil },
+			}
+			sm.Add(svc)
+
+			runDone, cancel := runInBackground(t, sm)
+			defer cancel()
+
+			require.ErrorIs(t, waitForRun(t, runDone), ErrInvalidSchedule)
+			assert.Zero(t, svc.runs.Load())
+		})
+	}
+}
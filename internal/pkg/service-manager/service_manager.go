@@ -2,6 +2,9 @@ package servicemanager
 
 import (
 	"context"
+	"errors"
+	"maps"
+	"runtime/debug"
 	"slices"
 	"sync"
 	"time"
@@ -27,7 +30,8 @@ type Service interface {
 
 // Retryable is optionally implemented by services that want
 // automatic restart on failure. MaxRetries returns the maximum
-// number of retry attempts (0 means no retries).
+// number of retry attempts (0 means no retries, UnlimitedRetries
+// or any negative value means no limit).
 // RetryDelay returns the delay between retries. Use
 // human-readable durations like 1s, 2m, 1h30m via
 // time.Duration.
@@ -36,12 +40,87 @@ type Retryable interface {
 	RetryDelay() time.Duration
 }
 
+// Backoff decides how long to wait before retrying a failed
+// attempt. attempt is the number of the attempt that failed,
+// counting from 1, and err is what it returned.
+type Backoff interface {
+	NextDelay(attempt int, err error) time.Duration
+}
+
+// RetryBackoffer is optionally implemented by restarting services
+// whose delay should vary between attempts, for example with
+// ExponentialBackoff or DecorrelatedJitter. The manager asks for a
+// Backoff once per run of the service and uses it instead of
+// RetryDelay, so stateful strategies start over with every
+// instance. A nil Backoff falls back to RetryDelay.
+type RetryBackoffer interface {
+	RetryBackoff() Backoff
+}
+
+// RetryClassifier is optionally implemented by services that can
+// tell transient failures from unrecoverable ones. When ShouldRetry
+// returns false the failure is terminal at once, whatever the
+// retry budget or restart policy. Errors marked with Permanent are
+// never retried and are not passed to ShouldRetry.
+type RetryClassifier interface {
+	ShouldRetry(err error) bool
+}
+
+// Restarter is optionally implemented by services that need a
+// RestartPolicy other than RestartOnFailure, such as daemons that
+// must come back after returning cleanly.
+type Restarter interface {
+	RestartPolicy() RestartPolicy
+}
+
+// Stabilizer is optionally implemented by restarting services
+// whose attempt count should start over once an attempt has run
+// for StabilityWindow, so a failure after a long healthy stretch
+// gets the whole retry budget and the shortest backoff again.
+type Stabilizer interface {
+	StabilityWindow() time.Duration
+}
+
 // AllowedFailure is optionally implemented by services whose
 // failure should not bring down the entire service manager.
 type AllowedFailure interface {
 	IsAllowedFailure() bool
 }
 
+// Job is optionally implemented by services that run to
+// completion rather than until cancelled. While the live graph
+// holds a job, Run returns nil once every service in it has
+// finished, so a batch binary exits when its work is done.
+type Job interface {
+	IsJob() bool
+}
+
+// Scheduled is optionally implemented by services whose Run is a
+// unit of work to call on a Schedule instead of once. Every run is
+// retried as Retryable says, and its outcome is recorded in Status;
+// a failed run never ends the schedule.
+type Scheduled interface {
+	Schedule() Schedule
+}
+
+// Replicated is optionally implemented by services that run as
+// several independent instances. The manager calls the factory
+// Replicas times and runs the instances as name#0, name#1 and so
+// on, each supervised on its own; SERVICES_REPLICAS overrides the
+// count. A dependency on name is ready once a quorum of them is.
+// Fewer than two replicas run a single instance under name.
+type Replicated interface {
+	Replicas() int
+}
+
+// Quorate is optionally implemented by Replicated services whose
+// dependents need fewer than all replicas ready: Quorum of them is
+// enough, and a loss only counts once fewer than Quorum are up.
+// SERVICES_QUORUM overrides it; a non-positive value means all.
+type Quorate interface {
+	Quorum() int
+}
+
 // Dependent is optionally implemented by services that must
 // start after other services. Dependencies returns the names
 // of services this service depends on.
@@ -49,6 +128,13 @@ type Dependent interface {
 	Dependencies() []string
 }
 
+// DependencyLossHandler is optionally implemented by Dependent
+// services that react to a lost dependency with a
+// DependencyLossPolicy other than CancelOnDependencyLoss.
+type DependencyLossHandler interface {
+	DependencyLossPolicy() DependencyLossPolicy
+}
+
 // ReadyNotifier is optionally implemented by services that
 // need to signal when they're actually ready to serve.
 // The service manager waits for the Ready channel to close
@@ -59,6 +145,51 @@ type ReadyNotifier interface {
 	Ready() <-chan struct{}
 }
 
+// HealthReporter is optionally implemented by services that can
+// tell whether they work, not only whether they run. While Run is
+// running, the manager calls CheckHealth at once and then every
+// SERVICEMANAGER_HEALTHINTERVAL, bounded by that interval: nil is
+// healthy, an error marked with Degraded is degraded and any other
+// error is unhealthy, with the error as the reason.
+type HealthReporter interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// Drainer is optionally implemented by services that finish
+// in-flight work before they are stopped, for example by no longer
+// accepting requests and waiting for the ones in progress. On
+// shutdown, after SERVICEMANAGER_PRESTOPDELAY, the manager calls
+// Drain while the run context is still live, dependents before
+// their dependencies, and cancels that context only once every
+// Drain returned or SERVICEMANAGER_DRAINTIMEOUT passed. A Drain
+// error is logged; the service is stopped either way.
+type Drainer interface {
+	Drain(ctx context.Context) error
+}
+
+// ReadyTimeouter is optionally implemented by ReadyNotifier
+// services that need a readiness deadline other than the
+// manager default (SERVICEMANAGER_READYTIMEOUT). A
+// non-positive value falls back to that default.
+type ReadyTimeouter interface {
+	ReadyTimeout() time.Duration
+}
+
+// PanicHandler is optionally implemented by services that handle
+// a panic in Run by a PanicPolicy other than the manager's
+// (SERVICEMANAGER_PANICPOLICY). An unknown policy falls back to it.
+type PanicHandler interface {
+	PanicPolicy() PanicPolicy
+}
+
+// ExitCoder is optionally implemented by services that map their
+// own errors to process exit codes. When the service ends the app,
+// ExitCode receives the underlying error and its result becomes the
+// ServiceError's ExitCode; 0 leaves the default mapping in place.
+type ExitCoder interface {
+	ExitCode(err error) int
+}
+
 // Commander is optionally implemented by services that expose
 // CLI subcommands. The returned commands are added under the
 // service name: ./app <servicename> <subcommand>.
@@ -70,39 +201,167 @@ type Commander interface {
 type ServiceFactory func() (Service, error)
 
 type servicesConfig struct {
-	Enabled []string `env:"SERVICES_ENABLED"`
+	Enabled  []string `env:"SERVICES_ENABLED"`
+	Replicas []string `env:"SERVICES_REPLICAS"`
+	Quorum   []string `env:"SERVICES_QUORUM"`
+}
+
+// config holds the manager's own tunables. A zero
+// ReadyTimeout waits for readiness without a deadline; a zero
+// MaxRestarts puts no limit on restarts across services, a zero
+// RestartWindow means defaultRestartWindow, an empty Strategy
+// means OneForOne and a zero HealthInterval means
+// defaultHealthInterval. An empty CrashDir writes no crash files,
+// an empty PanicPolicy means RecoverAndRetry, a zero PreStopDelay
+// drains at once and a zero DrainTimeout means defaultDrainTimeout.
+type config struct {
+	ReadyTimeout   time.Duration `env:"SERVICEMANAGER_READYTIMEOUT"`
+	MaxRestarts    int           `env:"SERVICEMANAGER_MAXRESTARTS"`
+	RestartWindow  time.Duration `env:"SERVICEMANAGER_RESTARTWINDOW"`
+	Strategy       Strategy      `env:"SERVICEMANAGER_STRATEGY"`
+	HealthInterval time.Duration `env:"SERVICEMANAGER_HEALTHINTERVAL"`
+	CrashDir       string        `env:"SERVICEMANAGER_CRASHDIR"`
+	PanicPolicy    PanicPolicy   `env:"SERVICEMANAGER_PANICPOLICY"`
+	JobTimeout     time.Duration `env:"SERVICEMANAGER_JOBTIMEOUT"`
+	PreStopDelay   time.Duration `env:"SERVICEMANAGER_PRESTOPDELAY"`
+	DrainTimeout   time.Duration `env:"SERVICEMANAGER_DRAINTIMEOUT"`
+}
+
+// serviceGroup names the services at the same dependency depth.
+// Group 0 has no in-process dependencies, group 1 depends only on
+// group 0, and so on. Scheduling is per service; groups only
+// describe the shape of the graph.
+type serviceGroup []string
+
+// serviceRun is one service instance's place in the startup graph.
+// deps holds in-process names only; dependents are derived from
+// the live graph because services can join it after Run started.
+// ready is closed once dependents may start; err is written
+// before exited is closed. resumed carries the attempts of the
+// instance this one replaces, and why it replaces it, when the
+// supervisor or the control API restarts it.
+// launched, stopped and handedOff are guarded by runsMu; handedOff
+// marks a run waiting for its group restart. avail tracks whether
+// dependents can rely on it after its first readiness. scheduled
+// is when it joined the graph, where its run phase begins.
+// finished, guarded by runsMu, marks a run that ended on its own
+// for good without failing Run.
+type serviceRun struct {
+	name      string
+	service   Service
+	deps      []string
+	ready     chan struct{}
+	avail     *availability
+	exited    chan struct{}
+	err       error
+	cancel    context.CancelCauseFunc
+	resumed   resumption
+	launched  bool
+	stopped   bool
+	handedOff bool
+	finished  bool
+	scheduled time.Time
+}
+
+func newServiceRun(
+	name string,
+	service Service,
+	deps []string,
+) *serviceRun {
+	return &serviceRun{
+		name:      name,
+		service:   service,
+		deps:      deps,
+		ready:     make(chan struct{}),
+		avail:     newAvailability(),
+		exited:    make(chan struct{}),
+		scheduled: time.Now(),
+	}
+}
+
+// failure describes the run ending for good with err after
+// attempts Run calls, with the exit code its ExitCoder maps err to.
+func (r *serviceRun) failure(attempts int, err error) *ServiceError {
+	return &ServiceError{
+		Service:  r.name,
+		Phase:    PhaseRun,
+		Attempts: attempts,
+		Duration: time.Since(r.scheduled),
+		ExitCode: exitCode(r.service, err),
+		Err:      err,
+	}
+}
+
+// active reports whether the run was launched and nobody has
+// started stopping it yet. Callers hold runsMu.
+func (r *serviceRun) active() bool {
+	return r.launched && !r.stopped
 }
 
-// serviceGroup is a set of services that can start concurrently.
-// Groups are ordered: group 0 starts first, then group 1, etc.
-type serviceGroup []Service
+// hasExited reports whether the service goroutine has returned.
+func (r *serviceRun) hasExited() bool {
+	select {
+	case <-r.exited:
+		return true
+	default:
+		return false
+	}
+}
 
 const (
 	defaultStopTimeout        = 30 * time.Second
+	defaultRestartWindow      = time.Minute
 	envVarNameServicesEnabled = "SERVICES_ENABLED"
 	scopeKeyService           = "service"
 )
 
 type ServiceManager struct {
-	factories     map[string]ServiceFactory
-	factoriesMu   sync.RWMutex
-	services      map[string]Service
-	servicesMutex sync.RWMutex
-	startGroups   []serviceGroup
-	startGroupsMu sync.RWMutex
-	wg            sync.WaitGroup
-	cancel        context.CancelFunc
-	cancelMu      sync.Mutex
-	stopOnce      sync.Once
-	stopTimeout   time.Duration
+	factories      map[string]ServiceFactory
+	templates      map[string]TemplateFactory
+	factoriesMu    sync.RWMutex
+	services       map[string]Service
+	quorums        map[string]int
+	servicesMutex  sync.RWMutex
+	runs           map[string]*serviceRun
+	runQuorums     map[string]int
+	runsChanged    chan struct{}
+	runsMu         sync.Mutex
+	stopping       bool
+	runCtx         context.Context //nolint:containedctx // see publishRuns
+	errCh          chan<- error
+	completed      chan struct{}
+	controlMu      sync.Mutex
+	wg             sync.WaitGroup
+	cancel         context.CancelCauseFunc
+	cancelMu       sync.Mutex
+	stopOnce       sync.Once
+	stopErr        error
+	stopExpired    context.Context //nolint:containedctx // see Stop
+	expireStop     context.CancelFunc
+	stopTimeout    time.Duration
+	readyTimeout   time.Duration
+	healthInterval time.Duration
+	crashDir       string
+	panicPolicy    PanicPolicy
+	jobTimeout     time.Duration
+	preStopDelay   time.Duration
+	drainTimeout   time.Duration
+	strategy       Strategy
+	status         statusBoard
+	events         eventBus
+	intensity      restartIntensity
 }
 
 func GetInstance() *ServiceManager {
 	serviceManagerOnce.Do(func() {
+		stopExpired, expireStop := context.WithCancel(context.Background())
+
 		serviceManagerInstance = &ServiceManager{
 			factories:   make(map[string]ServiceFactory),
 			services:    make(map[string]Service),
 			stopTimeout: defaultStopTimeout,
+			stopExpired: stopExpired,
+			expireStop:  expireStop,
 		}
 	})
 
@@ -146,15 +405,16 @@ func (s *ServiceManager) RegisteredNames() []string {
 	return names
 }
 
-// Instantiate creates a single service by calling its factory.
-// Used for Commander commands that need only one service.
+// Instantiate creates a single service by calling its factory, or
+// its template's for a name@instance name. Used for Commander
+// commands that need only one service.
 //
 //nolint:ireturn
 func (s *ServiceManager) Instantiate(
 	name string,
 ) (Service, error) {
 	s.factoriesMu.RLock()
-	factory, ok := s.factories[name]
+	factory, ok := s.factoryFor(name)
 	s.factoriesMu.RUnlock()
 
 	if !ok {
@@ -163,11 +423,12 @@ func (s *ServiceManager) Instantiate(
 		)
 	}
 
-	return factory()
+	return instantiate(name, factory)
 }
 
 // instantiateAll calls all factories (filtered by
-// SERVICES_ENABLED) and adds them to the services map.
+// SERVICES_ENABLED), and the templates of the instances it names,
+// and adds them to the services map.
 func (s *ServiceManager) instantiateAll() error {
 	return s.instantiateAllContext(context.Background())
 }
@@ -181,6 +442,11 @@ func (s *ServiceManager) instantiateAllContext(ctx context.Context) error {
 		return ctxerrors.Wrap(err, "parse enabled services")
 	}
 
+	replicas, err := parseReplicaConfig()
+	if err != nil {
+		return ctxerrors.Wrap(err, "parse service replicas")
+	}
+
 	for name, factory := range s.factories {
 		if !allEnabled &&
 			!slices.Contains(enabledServices, name) {
@@ -191,19 +457,93 @@ func (s *ServiceManager) instantiateAllContext(ctx context.Context) error {
 			continue
 		}
 
-		svc, err := factory()
-		if err != nil {
-			return ctxerrors.Wrapf(
-				err, "failed to create service %s", name,
-			)
+		if err := s.instantiateReplicas(
+			ctx, name, factory, replicas,
+		); err != nil {
+			return err
 		}
+	}
+
+	instances, err := s.templateInstances(enabledServices)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range instances {
+		factory, _ := s.factoryFor(name)
 
-		s.AddContext(ctx, svc)
+		if err := s.instantiateReplicas(
+			ctx, name, factory, replicas,
+		); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// instantiate calls factory, reporting its failure as a
+// *ServiceError.
+//
+//nolint:ireturn
+func instantiate(name string, factory ServiceFactory) (Service, error) {
+	start := time.Now()
+
+	svc, err := factory()
+	if err != nil {
+		return nil, &ServiceError{
+			Service:  name,
+			Phase:    PhaseInstantiate,
+			Duration: time.Since(start),
+			Err:      err,
+		}
+	}
+
+	return svc, nil
+}
+
+func parseConfig() (config, error) {
+	cfg := config{}
+	if err := gonfiguration.Parse(&cfg); err != nil {
+		return config{}, ctxerrors.Wrap(
+			errors.Join(ErrInvalidConfig, err),
+			"parse service manager config",
+		)
+	}
+
+	if cfg.Strategy == "" {
+		cfg.Strategy = OneForOne
+	}
+
+	if cfg.HealthInterval <= 0 {
+		cfg.HealthInterval = defaultHealthInterval
+	}
+
+	if cfg.PanicPolicy == "" {
+		cfg.PanicPolicy = RecoverAndRetry
+	}
+
+	if cfg.DrainTimeout <= 0 {
+		cfg.DrainTimeout = defaultDrainTimeout
+	}
+
+	if !cfg.Strategy.valid() {
+		return config{}, ctxerrors.Wrapf(
+			errors.Join(ErrInvalidConfig, ErrUnknownStrategy),
+			"%q", cfg.Strategy,
+		)
+	}
+
+	if !cfg.PanicPolicy.valid() {
+		return config{}, ctxerrors.Wrapf(
+			errors.Join(ErrInvalidConfig, ErrUnknownPanicPolicy),
+			"%q", cfg.PanicPolicy,
+		)
+	}
+
+	return cfg, nil
+}
+
 func parseEnabledServices() ([]string, bool) {
 	enabledServices, allEnabled, err := parseEnabledServicesContext(
 		context.Background(),
@@ -225,7 +565,9 @@ func parseEnabledServicesContext(
 ) ([]string, bool, error) {
 	cfg := servicesConfig{}
 	if err := gonfiguration.Parse(&cfg); err != nil {
-		return nil, false, ctxerrors.Wrap(err, "parse service config")
+		return nil, false, ctxerrors.Wrap(
+			errors.Join(ErrInvalidConfig, err), "parse service config",
+		)
 	}
 
 	if len(cfg.Enabled) == 0 {
@@ -303,6 +645,7 @@ func (s *ServiceManager) ClearServices() {
 	defer s.servicesMutex.Unlock()
 
 	s.services = make(map[string]Service)
+	s.quorums = nil
 }
 
 func (s *ServiceManager) Add(services ...Service) {
@@ -330,39 +673,76 @@ func withServiceScope(ctx context.Context, service string) context.Context {
 		ctx = context.Background()
 	}
 
+	if instance, ok := instanceOf(service); ok {
+		return ctxscope.Set(ctx,
+			ctxscope.Attr(scopeKeyService, service),
+			ctxscope.Attr(scopeKeyInstance, instance),
+		)
+	}
+
 	return ctxscope.Set(ctx, ctxscope.Attr(scopeKeyService, service))
 }
 
 func (s *ServiceManager) Run(ctx context.Context) error {
 	ctxscope.GetLogger(ctx).Info("running services")
 
+	cfg, err := parseConfig()
+	if err != nil {
+		return err
+	}
+
+	s.readyTimeout = cfg.ReadyTimeout
+	s.intensity.reset(cfg.MaxRestarts, cfg.RestartWindow)
+	s.strategy = cfg.Strategy
+	s.healthInterval = cfg.HealthInterval
+	s.crashDir = cfg.CrashDir
+	s.panicPolicy = cfg.PanicPolicy
+	s.jobTimeout = cfg.JobTimeout
+	s.preStopDelay = cfg.PreStopDelay
+	s.drainTimeout = cfg.DrainTimeout
+
 	if err := s.instantiateAllContext(ctx); err != nil {
 		return ctxerrors.Wrap(
 			err, "failed to instantiate services",
 		)
 	}
 
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
+	// The services outlive ctx until Stop has drained them; Stop
+	// then cancels them with the cause ctx ended with, if it did.
+	parent := ctx
+	ctx, cancel := context.WithCancelCause(context.WithoutCancel(parent))
+	defer cancel(nil)
 
 	s.cancelMu.Lock()
-	s.cancel = cancel
+	s.cancel = func(cause error) {
+		if parent.Err() != nil {
+			cause = context.Cause(parent)
+		}
+
+		cancel(cause)
+	}
 	s.cancelMu.Unlock()
 
-	s.servicesMutex.RLock()
-	defer s.servicesMutex.RUnlock()
+	// Run works on a snapshot so Add and ClearServices stay usable
+	// while it runs; services join the live graph through AddService.
+	services, quorums := s.snapshotServices()
 
 	errCh := make(chan error, 1)
 	defer close(errCh)
 
 	defer s.wg.Wait()
-	defer s.Stop(ctx)
 
-	if len(s.services) == 0 {
+	// Stop failures are logged as they happen and returned by Stop,
+	// which App calls again to report them. Stop drains the services
+	// and cancels ctx before it stops them, and neither their Drain
+	// nor their Stop must get a context that is done already.
+	defer func() { _ = s.Stop(context.WithoutCancel(ctx)) }()
+
+	if len(services) == 0 {
 		return ErrNoEnabledServices
 	}
 
-	groups, err := resolveOrderContext(ctx, s.services)
+	groups, dependents, err := resolveOrderContext(ctx, services)
 	if err != nil {
 		return ctxerrors.Wrap(
 			err, "failed to resolve service order",
@@ -371,156 +751,558 @@ func (s *ServiceManager) Run(ctx context.Context) error {
 
 	ctxscope.GetLogger(ctx).Debug("resolved service order",
 		"groups", len(groups),
-		"services", len(s.services),
+		"services", len(services),
 	)
 
-	s.runServiceGroups(ctx, groups, errCh)
+	s.status.reset(groups, services)
+
+	runs := buildServiceRuns(services, dependents)
+	completed := s.publishRuns(ctx, runs, quorums, errCh)
+
+	// Startup failures arrive beside service failures: a readiness
+	// gate can fail long after Run has entered the select below.
+	startErrCh := make(chan error, 1)
+
+	s.startServices(ctx, runs, startErrCh)
+
+	deadline, stopDeadline := s.jobDeadline(services)
+	defer stopDeadline()
 
 	select {
-	case <-ctx.Done():
+	case <-parent.Done():
 		ctxscope.GetLogger(ctx).Info("services run context done")
 
 		return nil
+	case <-ctx.Done():
+		ctxscope.GetLogger(ctx).Info("services stopped")
+
+		return nil
+	case <-completed:
+		ctxscope.GetLogger(ctx).Info("all jobs finished")
+
+		return nil
+	case <-deadline:
+		err := s.jobTimedOut()
+		cancel(err)
+
+		return err
 	case err := <-errCh:
+		cancel(siblingFailed(err))
+
 		return ctxerrors.Wrap(err, "service failed")
+	case err := <-startErrCh:
+		cancel(siblingFailed(err))
+
+		return ctxerrors.Wrap(err, "service startup failed")
 	}
 }
 
-func (s *ServiceManager) runServiceGroups(
-	ctx context.Context,
-	groups []serviceGroup,
-	errCh chan<- error,
+// siblingFailed is the cause the context of every service is
+// cancelled with when err, a failure, ends Run.
+func siblingFailed(err error) *SiblingError {
+	cause := &SiblingError{Err: err, sentinel: ErrSiblingFailed}
+
+	var serviceErr *ServiceError
+	if errors.As(err, &serviceErr) {
+		cause.Service = serviceErr.Service
+	}
+
+	return cause
+}
+
+// snapshotServices copies the services Run starts with and the
+// quorums of the replicated ones among them.
+func (s *ServiceManager) snapshotServices() (
+	map[string]Service,
+	map[string]int,
 ) {
-	s.startGroupsMu.Lock()
-	defer s.startGroupsMu.Unlock()
+	s.servicesMutex.RLock()
+	defer s.servicesMutex.RUnlock()
+
+	return maps.Clone(s.services), maps.Clone(s.quorums)
+}
 
-	for i, group := range groups {
-		names := make([]string, 0, len(group))
-		for _, svc := range group {
-			names = append(names, svc.Name())
+// buildServiceRuns pairs every service with its in-process
+// dependencies.
+func buildServiceRuns(
+	services map[string]Service,
+	dependents map[string][]string,
+) map[string]*serviceRun {
+	deps := make(map[string][]string, len(services))
+
+	for name, names := range dependents {
+		for _, dependent := range names {
+			deps[dependent] = append(deps[dependent], name)
 		}
+	}
 
-		ctxscope.GetLogger(ctx).Debug("starting service group",
-			"group", i,
-			"services", names,
-		)
+	runs := make(map[string]*serviceRun, len(services))
+	for name, svc := range services {
+		runs[name] = newServiceRun(name, svc, deps[name])
+	}
+
+	return runs
+}
 
-		launchedCh := make(chan struct{}, len(group))
+// publishRuns makes the live graph visible to the runtime
+// controls. The controls replace entries, so they get their own
+// copy of runs. Services started after Run has begun share Run's
+// context and error channel, which is why both are kept here, and
+// the quorums of its replica sets live with the graph so that
+// ClearServices leaves them alone.
+func (s *ServiceManager) publishRuns(
+	ctx context.Context,
+	runs map[string]*serviceRun,
+	quorums map[string]int,
+	errCh chan<- error,
+) <-chan struct{} {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+
+	s.runs = maps.Clone(runs)
+	s.runQuorums = quorums
+	s.runsChanged = make(chan struct{})
+	s.runCtx = ctx
+	s.errCh = errCh
+	s.completed = make(chan struct{})
+
+	return s.completed
+}
 
-		for _, service := range group {
-			s.wg.Add(1)
+// startServices schedules every service independently: each one
+// launches as soon as all of its own dependencies are ready, so a
+// slow service only delays the services that depend on it.
+// Services without dependencies launch before this returns, so an
+// early failure cannot make Run return before they have started.
+func (s *ServiceManager) startServices(
+	ctx context.Context,
+	runs map[string]*serviceRun,
+	startErrCh chan<- error,
+) {
+	for _, run := range runs {
+		launched := len(run.deps) == 0 && s.launch(ctx, run)
 
-			go func(svc Service) {
-				defer s.wg.Done()
+		s.wg.Go(func() {
+			err := s.startWhenDepsReady(ctx, run, launched)
+			if err == nil {
+				return
+			}
 
-				launchedCh <- struct{}{}
+			// Only the first startup failure is reported; Run is
+			// already returning because of it.
+			select {
+			case startErrCh <- err:
+			default:
+			}
+		})
+	}
+}
 
-				serviceCtx := withServiceScope(ctx, svc.Name())
+func (s *ServiceManager) startWhenDepsReady(
+	ctx context.Context,
+	run *serviceRun,
+	launched bool,
+) error {
+	if !launched {
+		ready, err := s.waitDependencies(ctx, run)
+		if err != nil {
+			// It fails as if its Run had, so the loss cascades.
+			run.avail.markGone(err)
+			s.handleServiceError(
+				withServiceScope(ctx, run.name),
+				run, run.failure(run.resumed.attempts, err),
+			)
 
-				s.runService(serviceCtx, svc, errCh)
-			}(service)
+			return nil
 		}
 
-		for range len(group) {
-			<-launchedCh
+		if !ready || !s.launch(ctx, run) {
+			return nil
 		}
+	}
 
-		s.waitGroupReady(ctx, group)
-		s.startGroups = append(s.startGroups, group)
+	ready, err := s.awaitReady(ctx, run)
+	if ready {
+		close(run.ready)
 	}
+
+	return err
 }
 
-func (s *ServiceManager) waitGroupReady(
+// launch starts the service goroutine under its own cancellable
+// context, unless the manager is stopping or run was replaced.
+func (s *ServiceManager) launch(
 	ctx context.Context,
-	group serviceGroup,
-) {
-	for _, svc := range group {
-		rn, ok := svc.(ReadyNotifier)
-		if !ok {
-			continue
-		}
+	run *serviceRun,
+) bool {
+	serviceCtx, cancel := context.WithCancelCause(
+		withServiceScope(ctx, run.name),
+	)
+
+	if !s.markLaunched(run, cancel) {
+		cancel(nil)
 
-		serviceCtx := withServiceScope(ctx, svc.Name())
+		return false
+	}
+
+	ctxscope.GetLogger(serviceCtx).Debug("starting service")
+
+	s.wg.Go(func() {
+		defer close(run.exited)
+		defer cancel(nil)
+
+		run.err = s.runService(serviceCtx, run)
+	})
+
+	return true
+}
+
+// markLaunched records run as launched unless Stop has already
+// taken its snapshot or a restart replaced it, in which case the
+// service must not launch.
+func (s *ServiceManager) markLaunched(
+	run *serviceRun,
+	cancel context.CancelCauseFunc,
+) bool {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+
+	if s.stopping || s.runs[run.name] != run {
+		return false
+	}
 
-		ctxscope.GetLogger(serviceCtx).Debug("waiting for service ready")
+	run.launched = true
+	run.cancel = cancel
 
+	return true
+}
+
+// awaitReady blocks until run may be depended upon and reports
+// whether it got there. Services without ReadyNotifier are ready
+// once launched. The error is a *ReadinessError when a service
+// with dependents times out or exits before signalling readiness.
+func (s *ServiceManager) awaitReady(
+	ctx context.Context,
+	run *serviceRun,
+) (bool, error) {
+	rn, ok := run.service.(ReadyNotifier)
+	if !ok {
+		return true, nil
+	}
+
+	serviceCtx := withServiceScope(ctx, run.name)
+
+	ctxscope.GetLogger(serviceCtx).Debug("waiting for service ready")
+
+	start := time.Now()
+
+	var timeoutCh <-chan time.Time
+
+	timeout := s.readyTimeoutFor(run.service)
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		timeoutCh = timer.C
+	}
+
+	select {
+	case <-rn.Ready():
+		ctxscope.GetLogger(serviceCtx).Debug("service ready")
+		s.status.transition(run.name, StateReady)
+		s.emit(Event{Type: EventReady, Service: run.name})
+
+		return true, nil
+	case <-ctx.Done():
+		return false, nil
+	case <-run.exited:
+		// The service may close Ready and return right after; a
+		// ready signal that made it out still counts.
 		select {
 		case <-rn.Ready():
-			ctxscope.GetLogger(serviceCtx).Debug("service ready")
-		case <-ctx.Done():
-			return
+			return true, nil
+		default:
+		}
+
+		// A run stopped or handed off for a restart is not done;
+		// whoever took it over gates its successor.
+		if ctx.Err() != nil || s.isStopped(run) {
+			return false, nil
+		}
+
+		reason := ErrExitedBeforeReady
+		if run.err != nil {
+			reason = errors.Join(ErrExitedBeforeReady, run.err)
 		}
+
+		return false, s.readinessFailure(serviceCtx, run, start, reason)
+	case <-timeoutCh:
+		return false, s.readinessFailure(
+			serviceCtx, run, start,
+			ctxerrors.Wrapf(ErrReadyTimeout, "after %s", timeout),
+		)
 	}
 }
 
-func (s *ServiceManager) runService(
+// readinessFailure turns a failed readiness gate, opened at start,
+// into an error when something was waiting on it. A service nothing
+// depends on blocks nobody, so its own failure handling is left to
+// decide.
+func (s *ServiceManager) readinessFailure(
 	ctx context.Context,
-	service Service,
-	errCh chan<- error,
-) {
-	maxRetries := 0
+	run *serviceRun,
+	start time.Time,
+	reason error,
+) error {
+	s.runsMu.Lock()
+	dependents := s.dependentsOf(run.name)
+	s.runsMu.Unlock()
+
+	if len(dependents) == 0 {
+		ctxscope.GetLogger(ctx).Warn(
+			"service never became ready; nothing depends on it",
+			"err", reason,
+		)
+
+		return nil
+	}
+
+	ctxscope.GetLogger(ctx).Error("service never became ready",
+		"dependents", dependents,
+		"err", reason,
+	)
+
+	return &ServiceError{
+		Service:  run.name,
+		Phase:    PhaseReady,
+		Attempts: s.status.attemptOf(run.name),
+		Duration: time.Since(start),
+		ExitCode: exitCode(run.service, reason),
+		Err: &ReadinessError{
+			Service:    run.name,
+			Dependents: dependents,
+			Err:        reason,
+		},
+	}
+}
 
-	retryable, ok := service.(Retryable)
-	if ok {
-		maxRetries = retryable.MaxRetries()
+func (s *ServiceManager) readyTimeoutFor(service Service) time.Duration {
+	rt, ok := service.(ReadyTimeouter)
+	if ok && rt.ReadyTimeout() > 0 {
+		return rt.ReadyTimeout()
 	}
 
+	return s.readyTimeout
+}
+
+// runService runs the service and restarts it as its restart
+// policy says. It returns the terminal error, or nil for a clean
+// exit or a cancelled context.
+func (s *ServiceManager) runService(
+	ctx context.Context,
+	run *serviceRun,
+) error {
+	service := run.service
+	plan := restartPlanFor(service)
+	name := run.name
+
 	var lastErr error
 
-	for attempt := range maxRetries + 1 {
+	attempt := run.resumed.attempts + 1
+	info := RuntimeInfo{
+		Service:       name,
+		MaxRetries:    plan.retryBudget(),
+		PrevErr:       run.resumed.err,
+		RestartReason: run.resumed.reason,
+	}
+
+	for ; ; attempt++ {
 		ctxscope.GetLogger(ctx).Debug("running service",
-			"attempt", attempt+1,
+			"attempt", attempt,
 		)
 
-		lastErr = s.safeRun(ctx, service)
-		if lastErr == nil {
-			ctxscope.GetLogger(ctx).Info("service exited cleanly")
+		// A scheduled service reports each of its runs instead.
+		if !isScheduled(service) {
+			s.status.attempt(name, attempt, attemptState(service))
+			s.emit(Event{Type: EventStarted, Service: name, Attempt: attempt})
+		}
 
-			return
+		startedAt := time.Now()
+		info.Attempt = attempt
+
+		lost, err := s.runAttempt(withRuntimeInfo(ctx, info), run)
+		if lost != nil {
+			again, err := s.dependencyLost(ctx, run, attempt, lost)
+			if !again {
+				return err
+			}
+
+			// The lost dependency ended this attempt, not the
+			// service, so it does not spend the retry budget.
+			attempt--
+			info.PrevErr = lost
+			info.RestartReason = RestartReasonDependencyLost
+
+			continue
 		}
 
-		if ctx.Err() != nil {
+		lastErr = err
+
+		// Shutdown has begun: the service returned while it drained
+		// and is not restarted, nor does its error end Run.
+		if ctx.Err() == nil && s.isStopped(run) {
+			ctxscope.GetLogger(ctx).Debug("service returned while draining",
+				"err", lastErr,
+			)
+
+			return nil
+		}
+
+		if !s.attemptEnded(ctx, name, attempt, lastErr, plan.policy) {
+			if lastErr == nil && ctx.Err() == nil {
+				s.finish(run)
+			}
+
+			return nil
+		}
+
+		run.avail.markDown(lastErr)
+
+		if plan.stable(time.Since(startedAt)) {
 			ctxscope.GetLogger(ctx).Debug(
-				"context cancelled during retry",
-				"attempt", attempt+1,
+				"service was stable, resetting attempts",
+				"attempt", attempt,
 			)
 
-			return
+			attempt = 1
 		}
 
-		if attempt >= maxRetries {
+		if !plan.restarts(attempt, lastErr) {
 			break
 		}
 
+		if !s.intensity.allow(time.Now()) {
+			err := s.exceedRestartIntensity(ctx, run, attempt, lastErr)
+			run.avail.markGone(err)
+
+			return err
+		}
+
+		s.status.retrying(name, lastErr)
+
 		if !s.waitRetryDelay(
-			ctx, retryable,
-			attempt, maxRetries, lastErr,
+			ctx, name, plan.backoff,
+			attempt, plan.maxRetries, lastErr,
 		) {
-			return
+			return nil
+		}
+
+		info.PrevErr = lastErr
+		info.RestartReason = RestartReasonFailure
+
+		if lastErr == nil {
+			info.RestartReason = RestartReasonExit
+		}
+
+		if s.strategy != OneForOne {
+			s.handOffRestart(run, resumption{
+				attempts: attempt,
+				reason:   info.RestartReason,
+				err:      lastErr,
+			})
+
+			return nil
 		}
 	}
 
 	ctxscope.GetLogger(ctx).Error("service failed",
-		"attempts", maxRetries+1,
+		"attempts", attempt,
 		"err", lastErr,
 	)
 
-	s.handleServiceError(ctx, service, lastErr, errCh)
+	failure := run.failure(attempt, lastErr)
+	if plan.exhausted(lastErr) {
+		failure.sentinel = ErrMaxRetriesReached
+	}
+
+	run.avail.markGone(lastErr)
+	s.handleServiceError(ctx, run, failure)
+
+	return lastErr
 }
 
-// waitRetryDelay logs the retry and waits for the delay.
-// Returns false if context was cancelled during the wait.
+// attemptEnded records how an attempt ended and reports whether
+// the restart policy gets a say: it does not once the context is
+// cancelled, nor after a clean exit unless the policy restarts
+// those.
+func (s *ServiceManager) attemptEnded(
+	ctx context.Context,
+	name string,
+	attempt int,
+	err error,
+	policy RestartPolicy,
+) bool {
+	if err != nil {
+		if ctx.Err() != nil {
+			ctxscope.GetLogger(ctx).Debug(
+				"context cancelled during retry",
+				"attempt", attempt,
+			)
+
+			return false
+		}
+
+		return true
+	}
+
+	ctxscope.GetLogger(ctx).Info("service exited cleanly")
+
+	// A cancelled service returning nil is being stopped; the stop
+	// events tell that story.
+	if ctx.Err() != nil {
+		s.status.transition(name, StateStopped)
+
+		return false
+	}
+
+	s.emit(Event{Type: EventExited, Service: name, Attempt: attempt})
+
+	if policy == RestartAlways {
+		return true
+	}
+
+	s.status.transition(name, StateStopped)
+
+	return false
+}
+
+// waitRetryDelay logs the retry and waits for the delay backoff
+// picks. Returns false if context was cancelled during the wait.
 func (s *ServiceManager) waitRetryDelay(
 	ctx context.Context,
-	retryable Retryable,
+	name string,
+	backoff Backoff,
 	attempt int,
 	maxRetries int,
 	err error,
 ) bool {
-	delay := retryable.RetryDelay()
+	delay := backoff.NextDelay(attempt, err)
+
+	s.emit(Event{
+		Type:    EventRetryScheduled,
+		Service: name,
+		Attempt: attempt,
+		Err:     err,
+		Delay:   delay,
+	})
 
-	ctxscope.GetLogger(ctx).Warn("service failed, retrying",
-		"attempt", attempt+1,
+	msg := "service failed, retrying"
+	if err == nil {
+		msg = "service exited, restarting"
+	}
+
+	ctxscope.GetLogger(ctx).Warn(msg,
+		"attempt", attempt,
 		"max_retries", maxRetries,
 		"retry_delay", delay,
 		"err", err,
@@ -542,21 +1324,60 @@ func (s *ServiceManager) waitRetryDelay(
 	}
 }
 
+// exitCode asks an ExitCoder service for the exit code of err.
+func exitCode(service Service, err error) int {
+	ec, ok := service.(ExitCoder)
+	if !ok || err == nil {
+		return 0
+	}
+
+	return ec.ExitCode(err)
+}
+
+func isAllowedFailure(service Service) bool {
+	af, ok := service.(AllowedFailure)
+
+	return ok && af.IsAllowedFailure()
+}
+
+// handleServiceError records a service that failed for good and,
+// unless it is allowed to fail, hands failure to Run.
 func (s *ServiceManager) handleServiceError(
 	ctx context.Context,
-	service Service,
-	err error,
-	errCh chan<- error,
+	run *serviceRun,
+	failure *ServiceError,
 ) {
-	af, ok := service.(AllowedFailure)
-	if ok && af.IsAllowedFailure() {
+	service := run.service
+	allowed := isAllowedFailure(service)
+
+	s.status.failed(run.name, failure.Err, allowed)
+	s.emit(Event{
+		Type:           EventFailed,
+		Service:        run.name,
+		Attempt:        failure.Attempts,
+		Err:            failure.Err,
+		AllowedFailure: allowed,
+	})
+
+	if allowed {
 		ctxscope.GetLogger(ctx).Warn("service failed (allowed failure)",
-			"err", err,
+			"err", failure.Err,
 		)
 
+		s.finish(run)
+
 		return
 	}
 
+	s.reportFailure(ctx, failure)
+}
+
+// reportFailure hands err, a failure that ends the app, to Run.
+func (s *ServiceManager) reportFailure(ctx context.Context, err error) {
+	s.runsMu.Lock()
+	errCh := s.errCh
+	s.runsMu.Unlock()
+
 	// Non-blocking on purpose. errCh has capacity 1 and Run receives from it at
 	// most once, so a plain send parks every concurrent failure after the first
 	// forever — and Run's `defer s.wg.Wait()` then never returns, turning a
@@ -577,8 +1398,51 @@ func (s *ServiceManager) handleServiceError(
 	}
 }
 
+// exceedRestartIntensity fails Run because automatic restarts
+// across all services outran the configured intensity. The service
+// that tipped it over is not restarted, and unlike its own failures
+// this one is never allowed.
+func (s *ServiceManager) exceedRestartIntensity(
+	ctx context.Context,
+	run *serviceRun,
+	attempt int,
+	lastErr error,
+) error {
+	maxRestarts, window := s.intensity.limits()
+
+	err := ctxerrors.Wrapf(
+		ErrRestartIntensity,
+		"more than %d restarts within %s, last by %s",
+		maxRestarts, window, run.name,
+	)
+	if lastErr != nil {
+		err = errors.Join(err, lastErr)
+	}
+
+	ctxscope.GetLogger(ctx).Error("restart intensity exceeded",
+		"max_restarts", maxRestarts,
+		"window", window,
+		"err", lastErr,
+	)
+
+	s.status.failed(run.name, err, false)
+	s.emit(Event{
+		Type:    EventFailed,
+		Service: run.name,
+		Attempt: attempt,
+		Err:     err,
+	})
+
+	s.reportFailure(ctx, run.failure(attempt, err))
+
+	return err
+}
+
+// safeRun calls Run of service, the instance running as name, and
+// handles a panic in it as its PanicPolicy says.
 func (s *ServiceManager) safeRun(
 	ctx context.Context,
+	name string,
 	service Service,
 ) (err error) {
 	defer func() {
@@ -587,110 +1451,281 @@ func (s *ServiceManager) safeRun(
 			return
 		}
 
+		pe := &PanicError{
+			Service: name,
+			Value:   r,
+			Stack:   debug.Stack(),
+		}
+
+		pe.CrashFile = s.writeCrashFile(ctx, pe)
+
+		policy := s.panicPolicyFor(service)
+
 		ctxscope.GetLogger(ctx).Error("service panicked",
 			"panic", r,
+			"panic_policy", policy,
+			"stack", string(pe.Stack),
+			"crash_file", pe.CrashFile,
 		)
 
-		err = ctxerrors.Wrapf(
-			ErrServicePanic, "%v", r,
-		)
+		switch policy {
+		case Repanic:
+			// Still inside the deferred call, so the frames that
+			// panicked are on the stack the runtime prints.
+			panic(r)
+		case RecoverAndFail:
+			err = Permanent(pe)
+		case RecoverAndRetry:
+			err = pe
+		}
+
+		s.emit(Event{
+			Type: EventPanicRecovered, Service: name, Err: err,
+		})
 	}()
 
 	return service.Run(ctx) //nolint:wrapcheck
 }
 
-func (s *ServiceManager) Stop(ctx context.Context) {
+// Stop drains the running services, cancels Run, with ErrShutdown
+// as the cause unless Run's context ended first, and stops every
+// running service. It returns the *ServiceError of every Stop that
+// failed or timed out, joined; later calls return the same.
+func (s *ServiceManager) Stop(ctx context.Context) error {
+	// Run stops without a deadline when its context ends, while the
+	// caller usually stops it with one at the same time. Whichever
+	// call drains, the first deadline of any caller cuts it short.
+	defer s.LimitStop(ctx)()
+
+	s.stopOnce.Do(func() {
+		ctxscope.GetLogger(ctx).Info("stopping services")
+		defer ctxscope.GetLogger(ctx).Info("stopped services")
+
+		runs := s.markStopping()
+		s.drain(ctx, runs)
+		s.cancelRun()
+		s.stopErr = s.stopRuns(ctx, runs)
+	})
+
+	// Run may have begun after the first call.
+	s.cancelRun()
+
+	return s.stopErr
+}
+
+// LimitStop makes the end of ctx cut the pre-stop delay and the
+// drain of Stop short, whichever call to Stop runs them, until the
+// returned function is called. Stop does so for its own context; a
+// caller that lets only one of its own Stop calls through to the
+// manager does so for the others.
+func (s *ServiceManager) LimitStop(ctx context.Context) func() {
+	stop := context.AfterFunc(ctx, s.expireStop)
+
+	return func() { stop() }
+}
+
+func (s *ServiceManager) cancelRun() {
 	s.cancelMu.Lock()
+	defer s.cancelMu.Unlock()
 
 	if s.cancel != nil {
-		s.cancel()
+		s.cancel(ErrShutdown)
 	}
+}
 
-	s.cancelMu.Unlock()
+// markStopping stops further launches and returns every active
+// service, marking each as stopping.
+func (s *ServiceManager) markStopping() []*serviceRun {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
 
-	s.stopOnce.Do(func() {
-		ctxscope.GetLogger(ctx).Info("stopping services")
-		defer ctxscope.GetLogger(ctx).Info("stopped services")
+	s.stopping = true
+
+	runs := make([]*serviceRun, 0, len(s.runs))
 
-		s.startGroupsMu.RLock()
-		defer s.startGroupsMu.RUnlock()
+	for _, run := range s.runs {
+		if !run.active() {
+			continue
+		}
+
+		run.stopped = true
+		runs = append(runs, run)
+	}
+
+	return runs
+}
+
+// dependentsOf returns, sorted, the services in the live graph
+// that depend on name directly. Callers hold runsMu.
+func (s *ServiceManager) dependentsOf(name string) []string {
+	var dependents []string
 
-		for i := len(s.startGroups) - 1; i >= 0; i-- {
-			s.stopGroup(ctx, s.startGroups[i])
+	for _, run := range s.runs {
+		if slices.Contains(run.deps, name) {
+			dependents = append(dependents, run.name)
 		}
-	})
+	}
+
+	slices.Sort(dependents)
+
+	return dependents
 }
 
-func (s *ServiceManager) stopGroup(
+// stopRuns stops each service only after every started service
+// that depends on it has stopped. Services with no path between
+// them stop concurrently, so one slow Stop delays only its own
+// dependencies. Their failures are joined in the order of runs.
+func (s *ServiceManager) stopRuns(
 	ctx context.Context,
-	group serviceGroup,
-) {
+	runs []*serviceRun,
+) error {
+	stopped := make(map[string]chan struct{}, len(runs))
+	dependents := make(map[string][]string, len(runs))
+
+	s.runsMu.Lock()
+
+	for _, run := range runs {
+		stopped[run.name] = make(chan struct{})
+		dependents[run.name] = s.dependentsOf(run.name)
+		s.status.transition(run.name, StateStopping)
+	}
+
+	s.runsMu.Unlock()
+
 	var wg sync.WaitGroup
 
-	for _, service := range group {
-		wg.Add(1)
+	errs := make([]error, len(runs))
+
+	for i, run := range runs {
+		wg.Go(func() {
+			defer close(stopped[run.name])
 
-		go func(svc Service) {
-			defer wg.Done()
+			for _, dependent := range dependents[run.name] {
+				if ch, ok := stopped[dependent]; ok {
+					<-ch
+				}
+			}
 
-			serviceCtx := withServiceScope(ctx, svc.Name())
+			serviceCtx := withServiceScope(ctx, run.name)
 
 			ctxscope.GetLogger(serviceCtx).Debug("stopping service")
 
-			s.stopServiceWithTimeout(serviceCtx, svc)
-		}(service)
+			errs[i] = s.stopServiceWithTimeout(
+				serviceCtx, run.name, run.service,
+			)
+			s.status.transition(run.name, StateStopped)
+		})
 	}
 
 	wg.Wait()
+
+	return errors.Join(errs...)
 }
 
+// stopServiceWithTimeout calls Stop of service, the instance
+// running as name, and returns a *ServiceError when it fails or
+// outlives the stop timeout.
 func (s *ServiceManager) stopServiceWithTimeout(
 	ctx context.Context,
+	name string,
 	service Service,
-) {
-	done := make(chan struct{})
+) error {
+	done := make(chan error, 1)
+	start := time.Now()
 
-	go func() {
-		defer close(done)
+	s.emit(Event{Type: EventStopStarted, Service: name})
 
+	go func() {
 		ctx, cancel := context.WithTimeout(
 			ctx, s.stopTimeout,
 		)
 		defer cancel()
 
+		var failure error
+
 		if err := service.Stop(ctx); err != nil {
+			failure = s.stopFailure(name, service, start, err, nil)
+
 			ctxscope.GetLogger(ctx).Error(
 				"failed to stop service",
 				"err", err,
 			)
 		}
+
+		s.emit(Event{
+			Type: EventStopFinished, Service: name, Err: failure,
+		})
+
+		done <- failure
 	}()
 
 	timer := time.NewTimer(s.stopTimeout)
 	defer timer.Stop()
 
 	select {
-	case <-done:
+	case err := <-done:
+		return err
 	case <-timer.C:
+		err := s.stopFailure(
+			name, service, start, nil, ErrStopTimeout,
+		)
+
 		ctxscope.GetLogger(ctx).Error("service stop timed out",
 			"timeout", s.stopTimeout,
 		)
+		s.emit(Event{
+			Type:    EventStopTimedOut,
+			Service: name,
+			Timeout: s.stopTimeout,
+			Err:     err,
+		})
+
+		return err
+	}
+}
+
+// stopFailure describes a Stop call of name begun at start that
+// failed with err or, matching sentinel, did not return in time.
+func (s *ServiceManager) stopFailure(
+	name string,
+	service Service,
+	start time.Time,
+	err error,
+	sentinel error,
+) *ServiceError {
+	return &ServiceError{
+		Service:  name,
+		Phase:    PhaseStop,
+		Attempts: s.status.attemptOf(name),
+		Duration: time.Since(start),
+		ExitCode: exitCode(service, err),
+		Err:      err,
+		sentinel: sentinel,
 	}
 }
 
 func resolveOrder(
 	services map[string]Service,
 ) ([]serviceGroup, error) {
-	return resolveOrderContext(context.Background(), services)
+	groups, _, err := resolveOrderContext(context.Background(), services)
+
+	return groups, err
 }
 
+// resolveOrderContext returns the start groups together with the
+// in-process dependents of each service.
 func resolveOrderContext(
 	ctx context.Context,
 	services map[string]Service,
-) ([]serviceGroup, error) {
+) ([]serviceGroup, map[string][]string, error) {
 	inDegree, dependents := buildDepGraphContext(ctx, services)
 
-	return topoSort(services, inDegree, dependents)
+	groups, err := topoSort(services, inDegree, dependents)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return groups, dependents, nil
 }
 
 func buildDepGraphContext(
@@ -713,7 +1748,8 @@ func buildDepGraphContext(
 		}
 
 		for _, depName := range dep.Dependencies() {
-			if _, exists := services[depName]; !exists {
+			depNames := instanceNames(services, depName)
+			if len(depNames) == 0 {
 				ctxscope.GetLogger(
 					withServiceScope(ctx, name),
 				).Warn(
@@ -724,11 +1760,13 @@ func buildDepGraphContext(
 				continue
 			}
 
-			inDegree[name]++
+			for _, depName := range depNames {
+				inDegree[name]++
 
-			dependents[depName] = append(
-				dependents[depName], name,
-			)
+				dependents[depName] = append(
+					dependents[depName], name,
+				)
+			}
 		}
 	}
 
@@ -755,12 +1793,7 @@ func topoSort(
 	}
 
 	for len(queue) > 0 {
-		group := make(serviceGroup, 0, len(queue))
-		for _, name := range queue {
-			group = append(group, services[name])
-		}
-
-		groups = append(groups, group)
+		groups = append(groups, serviceGroup(queue))
 		processed += len(queue)
 
 		nextQueue := make([]string, 0)
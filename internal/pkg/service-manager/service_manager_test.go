@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -30,13 +32,13 @@ const (
 	startedPollInterval = time.Millisecond
 )
 
-// waitForStartedServices blocks until the manager has registered `want`
-// services into start groups.
+// waitForStartedServices blocks until the manager has launched `want`
+// services.
 //
-// That is the precondition Stop actually has: it iterates startGroups, and a
-// group lands there only after every service goroutine has launched and
-// waitGroupReady has returned. A Stop arriving before the append finds nothing
-// to stop, so every "should have Stop called" assertion fails.
+// That is the precondition Stop actually has: it stops the services marked as
+// launched, and a service is marked only once its dependencies are ready and
+// its goroutine is being launched. A Stop arriving before that finds
+// nothing to stop, so every "should have Stop called" assertion fails.
 //
 // This replaced a time.Sleep that stood in for the same condition. The sleep
 // was load-bearing rather than cosmetic — setting it to zero fails these tests
@@ -47,17 +49,20 @@ func waitForStartedServices(t *testing.T, sm *ServiceManager, want int) {
 	t.Helper()
 
 	require.Eventually(t, func() bool {
-		sm.startGroupsMu.RLock()
-		defer sm.startGroupsMu.RUnlock()
+		sm.runsMu.Lock()
+		defer sm.runsMu.Unlock()
 
-		started := 0
-		for _, group := range sm.startGroups {
-			started += len(group)
+		launched := 0
+
+		for _, run := range sm.runs {
+			if run.launched {
+				launched++
+			}
 		}
 
-		return started >= want
+		return launched >= want
 	}, runHangGuard, startedPollInterval,
-		"manager never registered %d service(s) into a start group", want)
+		"manager never launched %d service(s)", want)
 }
 
 // waitForRunCalled blocks until every mock service has entered Run. Waiting for
@@ -306,6 +311,8 @@ func TestServiceManager_Stop(t *testing.T) {
 
 			ctx := context.Background()
 
+			var stopErr error
+
 			// First run the services if there are any, so the manager
 			// registers them and Stop has something to stop.
 			if len(tc.services) > 0 {
@@ -328,13 +335,23 @@ func TestServiceManager_Stop(t *testing.T) {
 				waitForStartedServices(t, sm, len(tc.services))
 
 				// Now stop them
-				sm.Stop(ctx)
+				stopErr = sm.Stop(ctx)
 
 				// Wait for run to complete
 				<-runDone
 			} else {
 				// For empty services test, just call stop
-				sm.Stop(ctx)
+				stopErr = sm.Stop(ctx)
+			}
+
+			if tc.expectStopErrors {
+				require.ErrorIs(t, stopErr, errTestServiceStop)
+
+				var serviceErr *ServiceError
+				require.ErrorAs(t, stopErr, &serviceErr)
+				assert.Equal(t, PhaseStop, serviceErr.Phase)
+			} else {
+				require.NoError(t, stopErr)
 			}
 
 			// Verify all services had Stop called (only for non-empty services)
@@ -357,7 +374,7 @@ func TestServiceManager_Stop(t *testing.T) {
 				}
 
 				// Call stop again - this should be a no-op due to sync.Once
-				sm.Stop(ctx)
+				assert.Equal(t, stopErr, sm.Stop(ctx))
 
 				// Services should NOT be stopped again due to sync.Once
 				for _, svc := range tc.services {
@@ -673,6 +690,175 @@ func TestServiceManager_RunWithRetries(t *testing.T) {
 	}
 }
 
+func TestServiceManager_ServiceError(t *testing.T) {
+	testCases := []struct {
+		name          string
+		setup         func(sm *ServiceManager)
+		phase         Phase
+		attempts      int
+		maxRetriesHit bool
+		exitCode      int
+	}{
+		{
+			name: "retries exhausted",
+			setup: func(sm *ServiceManager) {
+				svc := NewRetryableMockService("fail", 2)
+				svc.WithRunError(errTestService)
+				sm.Add(svc)
+			},
+			phase:         PhaseRun,
+			attempts:      3,
+			maxRetriesHit: true,
+		},
+		{
+			name: "not retryable",
+			setup: func(sm *ServiceManager) {
+				sm.Add(NewMockService("fail").WithRunError(errTestService))
+			},
+			phase:    PhaseRun,
+			attempts: 1,
+		},
+		{
+			name: "permanent error",
+			setup: func(sm *ServiceManager) {
+				svc := NewRetryableMockService("fail", 2)
+				svc.WithRunError(Permanent(errTestService))
+				sm.Add(svc)
+			},
+			phase:    PhaseRun,
+			attempts: 1,
+		},
+		{
+			name: "exit coder",
+			setup: func(sm *ServiceManager) {
+				sm.Add(&exitCodingService{
+					MockService: NewMockService("fail").
+						WithRunError(errTestService),
+				})
+			},
+			phase:    PhaseRun,
+			attempts: 1,
+			exitCode: testExitCode,
+		},
+		{
+			name: "factory error",
+			setup: func(sm *ServiceManager) {
+				sm.Register("fail", func() (Service, error) {
+					return nil, errTestService
+				})
+			},
+			phase: PhaseInstantiate,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ResetInstance()
+
+			sm := GetInstance()
+			tc.setup(sm)
+
+			runDone := make(chan error, 1)
+
+			go func() {
+				runDone <- sm.Run(t.Context())
+			}()
+
+			var err error
+
+			select {
+			case err = <-runDone:
+			case <-time.After(runHangGuard):
+				t.Fatal("Run did not fail")
+			}
+
+			require.ErrorIs(t, err, errTestService)
+
+			var serviceErr *ServiceError
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, "fail", serviceErr.Service)
+			assert.Equal(t, tc.phase, serviceErr.Phase)
+			assert.Equal(t, tc.attempts, serviceErr.Attempts)
+			assert.Equal(t, tc.exitCode, serviceErr.ExitCode)
+			assert.Equal(t,
+				tc.maxRetriesHit, errors.Is(err, ErrMaxRetriesReached),
+			)
+		})
+	}
+}
+
+const testExitCode = 42
+
+// exitCodingService maps errTestService to testExitCode.
+type exitCodingService struct {
+	*MockService
+}
+
+func (e *exitCodingService) ExitCode(err error) int {
+	if errors.Is(err, errTestService) {
+		return testExitCode
+	}
+
+	return 0
+}
+
+// stuckStopService ignores the context of its Stop until released.
+type stuckStopService struct {
+	*TestService
+	release chan struct{}
+}
+
+func (s *stuckStopService) Stop(context.Context) error {
+	<-s.release
+
+	return nil
+}
+
+func TestServiceManager_StopTimeoutServiceError(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+	sm.stopTimeout = 10 * time.Millisecond
+
+	svc := &stuckStopService{
+		TestService: NewTestService("stuck"),
+		release:     make(chan struct{}),
+	}
+	defer close(svc.release)
+
+	sm.Add(svc)
+
+	events, unsubscribe := sm.Subscribe(64)
+	defer unsubscribe()
+
+	stop := runControlled(t, sm, 1)
+	stop()
+
+	for {
+		select {
+		case event := <-events:
+			if event.Type != EventStopTimedOut {
+				continue
+			}
+
+			require.ErrorIs(t, event.Err, ErrStopTimeout)
+
+			var serviceErr *ServiceError
+			require.ErrorAs(t, event.Err, &serviceErr)
+			assert.Equal(t, "stuck", serviceErr.Service)
+			assert.Equal(t, PhaseStop, serviceErr.Phase)
+			assert.Equal(t, 1, serviceErr.Attempts)
+
+			// Run already stopped it; Stop reports the same again.
+			require.ErrorIs(t, sm.Stop(t.Context()), ErrStopTimeout)
+
+			return
+		case <-time.After(runHangGuard):
+			t.Fatal("stop never timed out")
+		}
+	}
+}
+
 func TestServiceManager_RunWithAllowedFailure(t *testing.T) {
 	testCases := []struct {
 		name        string
@@ -986,6 +1172,13 @@ func TestServiceManager_PanicRecovery(t *testing.T) {
 			case err := <-done:
 				assert.Error(t, err)
 				assert.ErrorIs(t, err, ErrServicePanic)
+
+				var pe *PanicError
+				require.ErrorAs(t, err, &pe)
+				assert.Equal(t, "panicker", pe.Service)
+				assert.Equal(t, tc.panicValue, pe.Value)
+				assert.Contains(t, string(pe.Stack), "(*panicService).Run")
+				assert.Empty(t, pe.CrashFile)
 			case <-time.After(2 * time.Second):
 				t.Fatal("timed out")
 			}
@@ -993,6 +1186,27 @@ func TestServiceManager_PanicRecovery(t *testing.T) {
 	}
 }
 
+func TestServiceManager_PanicCrashFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "crashes")
+	t.Setenv("SERVICEMANAGER_CRASHDIR", dir)
+
+	ResetInstance()
+
+	sm := GetInstance()
+	sm.Add(&panicService{name: "panicker", value: "oh no"})
+
+	var pe *PanicError
+	require.ErrorAs(t, sm.Run(t.Context()), &pe)
+	require.NotEmpty(t, pe.CrashFile)
+	assert.Equal(t, dir, filepath.Dir(pe.CrashFile))
+
+	report, err := os.ReadFile(pe.CrashFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(report), "service: panicker")
+	assert.Contains(t, string(report), "panic: oh no")
+	assert.Contains(t, string(report), "(*panicService).Run")
+}
+
 func TestServiceManager_ReverseOrderShutdown(
 	t *testing.T,
 ) {
@@ -1452,3 +1666,262 @@ func TestParseEnabledServices(t *testing.T) {
 		})
 	}
 }
+
+type allowedFailureReadyService struct {
+	*ReadyMockService
+}
+
+func (a *allowedFailureReadyService) IsAllowedFailure() bool {
+	return true
+}
+
+func TestServiceManager_ReadinessGateFailures(t *testing.T) {
+	testCases := []struct {
+		name         string
+		envTimeout   string
+		services     func() []Service
+		expectErr    error
+		expectReady  string
+		expectBlocks []string
+	}{
+		{
+			name:       "default timeout blocks dependents",
+			envTimeout: "20ms",
+			services: func() []Service {
+				return []Service{
+					NewReadyMockService("db"),
+					NewDependentMockService("api", "db"),
+					NewDependentMockService("worker", "db"),
+				}
+			},
+			expectErr:    ErrReadyTimeout,
+			expectReady:  "db",
+			expectBlocks: []string{"api", "worker"},
+		},
+		{
+			name: "per-service timeout overrides default",
+			services: func() []Service {
+				return []Service{
+					NewReadyMockService("db").
+						WithReadyTimeout(20 * time.Millisecond),
+					NewDependentMockService("api", "db"),
+				}
+			},
+			expectErr:    ErrReadyTimeout,
+			expectReady:  "db",
+			expectBlocks: []string{"api"},
+		},
+		{
+			name: "allowed failure exits before ready",
+			services: func() []Service {
+				db := NewReadyMockService("db")
+				db.WithRunError(errTestService)
+
+				return []Service{
+					&allowedFailureReadyService{ReadyMockService: db},
+					NewDependentMockService("api", "db"),
+				}
+			},
+			expectErr:    ErrExitedBeforeReady,
+			expectReady:  "db",
+			expectBlocks: []string{"api"},
+		},
+		{
+			name: "clean exit before ready",
+			services: func() []Service {
+				// A closed stop channel makes Run return nil at once.
+				db := NewReadyMockService("db")
+				_ = db.Stop(context.Background())
+
+				return []Service{
+					db,
+					NewDependentMockService("api", "db"),
+				}
+			},
+			expectErr:    ErrExitedBeforeReady,
+			expectReady:  "db",
+			expectBlocks: []string{"api"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ResetInstance()
+
+			if tc.envTimeout != "" {
+				t.Setenv("SERVICEMANAGER_READYTIMEOUT", tc.envTimeout)
+			}
+
+			sm := GetInstance()
+			sm.Add(tc.services()...)
+
+			done := make(chan error, 1)
+
+			go func() {
+				done <- sm.Run(t.Context())
+			}()
+
+			select {
+			case err := <-done:
+				require.ErrorIs(t, err, tc.expectErr)
+
+				var serviceErr *ServiceError
+				require.ErrorAs(t, err, &serviceErr)
+				assert.Equal(t, tc.expectReady, serviceErr.Service)
+				assert.Equal(t, PhaseReady, serviceErr.Phase)
+
+				var readinessErr *ReadinessError
+				require.ErrorAs(t, err, &readinessErr)
+				assert.Equal(t, tc.expectReady, readinessErr.Service)
+				assert.Equal(t, tc.expectBlocks, readinessErr.Dependents)
+			case <-time.After(runReturnTimeout):
+				t.Fatal("Run hung on a readiness gate")
+			}
+		})
+	}
+}
+
+func TestServiceManager_ReadinessGateWithoutDependents(t *testing.T) {
+	ResetInstance()
+	t.Setenv("SERVICEMANAGER_READYTIMEOUT", "10ms")
+
+	sm := GetInstance()
+
+	// Nothing depends on lonely, so its missing ready signal blocks
+	// nobody and the manager keeps running until cancelled.
+	lonely := NewReadyMockService("lonely")
+	other := NewMockService("other")
+	sm.Add(lonely, other)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	waitThenCancel(cancel, func() bool {
+		return lonely.WasRunCalled() && other.WasRunCalled()
+	})
+
+	assert.NoError(t, sm.Run(ctx))
+}
+
+// TestServiceManager_PerServiceScheduling proves a slow dependency only
+// delays its own dependents: worker depends on cache alone, so it must start
+// while db is still not ready.
+func TestServiceManager_PerServiceScheduling(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	db := NewReadyMockService("db")
+	cache := NewMockService("cache")
+	worker := NewDependentMockService("worker", "cache")
+	api := NewDependentMockService("api", "db")
+
+	sm.Add(db, cache, worker, api)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	runDone := make(chan error, 1)
+
+	go func() {
+		runDone <- sm.Run(ctx)
+	}()
+
+	require.Eventually(t, worker.WasRunCalled,
+		runHangGuard, startedPollInterval,
+		"worker waited on an unrelated dependency")
+	assert.False(t, api.WasRunCalled(),
+		"api started before db was ready")
+
+	db.SignalReady()
+
+	require.Eventually(t, api.WasRunCalled,
+		runHangGuard, startedPollInterval,
+		"api never started after db became ready")
+
+	cancel()
+
+	select {
+	case err := <-runDone:
+		assert.NoError(t, err)
+	case <-time.After(runHangGuard):
+		t.Fatal("Run did not return after cancel")
+	}
+}
+
+// TestServiceManager_PerServiceStopOrder proves Stop orders each service
+// after its own dependents only. metrics shares no edge with api, so it must
+// be able to stop while api is still stopping; a layered shutdown would hold
+// metrics back until api finished.
+func TestServiceManager_PerServiceStopOrder(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+
+	var (
+		stopOrder []string
+		mu        sync.Mutex
+	)
+
+	recordStop := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		stopOrder = append(stopOrder, name)
+	}
+
+	metricsStopped := make(chan struct{})
+
+	metrics := &stopTrackingService{
+		Service: NewTestService("metrics"),
+		onStop: func() {
+			recordStop("metrics")
+			close(metricsStopped)
+		},
+	}
+
+	db := &stopTrackingService{
+		Service: NewTestService("db"),
+		onStop:  func() { recordStop("db") },
+	}
+
+	api := &dependentStopTrackingService{
+		stopTrackingService: stopTrackingService{
+			Service: NewTestService("api"),
+			onStop: func() {
+				select {
+				case <-metricsStopped:
+				case <-time.After(runHangGuard):
+				}
+
+				recordStop("api")
+			},
+		},
+		deps: []string{"db"},
+	}
+
+	sm.Add(metrics, db, api)
+
+	ctx, cancel := context.WithCancel(t.Context())
+
+	runDone := make(chan error, 1)
+
+	go func() {
+		runDone <- sm.Run(ctx)
+	}()
+
+	waitForStartedServices(t, sm, 3)
+	cancel()
+
+	select {
+	case err := <-runDone:
+		assert.NoError(t, err)
+	case <-time.After(runHangGuard):
+		t.Fatal("Run did not return after cancel")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, []string{"metrics", "api", "db"}, stopOrder)
+}
@@ -0,0 +1,400 @@
+package servicemanager
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// State is where a service is in its lifecycle.
+type State string
+
+const (
+	// StatePending services wait for their dependencies, at start
+	// or after losing one.
+	StatePending State = "pending"
+	// StateStarting services run but have not signalled readiness.
+	StateStarting State = "starting"
+	// StateReady services run and have signalled readiness.
+	StateReady State = "ready"
+	// StateRunning services run and do not report readiness.
+	StateRunning State = "running"
+	// StateScheduled services wait for their next scheduled run.
+	StateScheduled State = "scheduled"
+	// StateRetrying services failed, or exited under RestartAlways,
+	// and wait for their next attempt.
+	StateRetrying State = "retrying"
+	// StateFailed services used up their attempts.
+	StateFailed State = "failed"
+	// StateAllowedFailed services failed but are allowed to.
+	StateAllowedFailed State = "allowed-failed"
+	// StateDraining services still run, but shutdown has begun:
+	// they finish in-flight work before they are cancelled.
+	StateDraining State = "draining"
+	// StateStopping services are being stopped.
+	StateStopping State = "stopping"
+	// StateStopped services exited cleanly or were stopped.
+	StateStopped State = "stopped"
+)
+
+// ServiceStatus is a point-in-time view of one service.
+type ServiceStatus struct {
+	Name  string
+	State State
+	// Attempt counts Run calls of the current instance, from 1,
+	// and starts over after a Stabilizer's stability window.
+	Attempt   int
+	LastError error
+	// StartedAt is when the current attempt began.
+	StartedAt time.Time
+	// Uptime is the time since StartedAt while the service runs.
+	Uptime time.Duration
+	// Restarts counts retries, policy restarts, runtime restarts
+	// and restarts after a lost dependency.
+	Restarts int
+	// Group is the service's startup depth: 0 without in-process
+	// dependencies, otherwise one more than its deepest dependency.
+	Group int
+	// Health is how well the service works; see
+	// ServiceManager.Health.
+	Health ServiceHealth
+	// AllowedFailure marks a service whose trouble only degrades
+	// the app.
+	AllowedFailure bool
+	// NextRun is when a Scheduled service runs next, jitter
+	// included.
+	NextRun time.Time
+	// LastExecution is the outcome of the last run of a Scheduled
+	// service that has finished one.
+	LastExecution Execution
+}
+
+// Status returns the state of every service in the live graph,
+// ordered by dependency group and then by name. It is empty
+// before Run has resolved the graph.
+func (s *ServiceManager) Status() []ServiceStatus {
+	return s.status.snapshot(time.Now())
+}
+
+type statusEntry struct {
+	state     State
+	attempt   int
+	lastErr   error
+	startedAt time.Time
+	restarts  int
+	group     int
+	allowed   bool
+	checked   ServiceHealth
+	nextRun   time.Time
+	lastExec  Execution
+	draining  bool
+}
+
+// statusBoard holds the lifecycle state machine of every service.
+// Its lock is never held while calling out, so any code path may
+// record a transition.
+type statusBoard struct {
+	mu      sync.Mutex
+	entries map[string]*statusEntry
+}
+
+// reset starts a new graph with every service pending.
+func (b *statusBoard) reset(
+	groups []serviceGroup,
+	services map[string]Service,
+) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.entries = make(map[string]*statusEntry)
+
+	for depth, group := range groups {
+		for _, name := range group {
+			b.entries[name] = &statusEntry{
+				state:   StatePending,
+				group:   depth,
+				allowed: isAllowedFailure(services[name]),
+			}
+		}
+	}
+}
+
+// add records a service that joined the graph after Run started,
+// one group deeper than the deepest of its deps.
+func (b *statusBoard) add(name string, deps []string, allowed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.entries == nil {
+		b.entries = make(map[string]*statusEntry)
+	}
+
+	group := 0
+
+	for _, dep := range deps {
+		if entry, ok := b.entries[dep]; ok {
+			group = max(group, entry.group+1)
+		}
+	}
+
+	b.entries[name] = &statusEntry{
+		state:   StatePending,
+		group:   group,
+		allowed: allowed,
+	}
+}
+
+func (b *statusBoard) remove(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.entries, name)
+}
+
+func (b *statusBoard) update(name string, fn func(entry *statusEntry)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entry, ok := b.entries[name]
+	if !ok {
+		return
+	}
+
+	fn(entry)
+}
+
+// attempt records the start of a Run call.
+func (b *statusBoard) attempt(name string, attempt int, state State) {
+	b.update(name, func(entry *statusEntry) {
+		entry.state = state
+		entry.attempt = attempt
+		entry.startedAt = time.Now()
+		entry.checked = ServiceHealth{}
+	})
+}
+
+// attemptOf returns the attempt name is on.
+func (b *statusBoard) attemptOf(name string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entry, ok := b.entries[name]
+	if !ok {
+		return 0
+	}
+
+	return entry.attempt
+}
+
+// checked records a health check of the running attempt and
+// reports whether its state changed.
+func (b *statusBoard) checked(name string, health ServiceHealth) bool {
+	changed := false
+
+	b.update(name, func(entry *statusEntry) {
+		changed = entry.checked.State != health.State
+		entry.checked = health
+	})
+
+	return changed
+}
+
+// retrying records a restart after an attempt returned err. A
+// clean exit keeps the previous error visible.
+func (b *statusBoard) retrying(name string, err error) {
+	b.update(name, func(entry *statusEntry) {
+		entry.state = StateRetrying
+		entry.restarts++
+
+		if err != nil {
+			entry.lastErr = err
+		}
+	})
+}
+
+func (b *statusBoard) failed(name string, err error, allowed bool) {
+	b.update(name, func(entry *statusEntry) {
+		entry.state = StateFailed
+		if allowed {
+			entry.state = StateAllowedFailed
+		}
+
+		entry.lastErr = err
+	})
+}
+
+// scheduled records when a Scheduled service runs next.
+func (b *statusBoard) scheduled(name string, next time.Time) {
+	b.update(name, func(entry *statusEntry) {
+		entry.nextRun = next
+	})
+}
+
+// executed records the outcome of a scheduled run, after which the
+// service waits for its next one.
+func (b *statusBoard) executed(name string, result Execution) {
+	b.update(name, func(entry *statusEntry) {
+		entry.state = StateScheduled
+		entry.lastExec = result
+
+		if result.Err != nil {
+			entry.lastErr = result.Err
+		}
+	})
+}
+
+// waiting records an attempt that a lost dependency ended: the
+// service waits for it to come back before running again.
+func (b *statusBoard) waiting(name string, err error) {
+	b.update(name, func(entry *statusEntry) {
+		entry.state = StatePending
+		entry.restarts++
+		entry.lastErr = err
+	})
+}
+
+// restarted records that a fresh instance replaces the current one.
+func (b *statusBoard) restarted(name string) {
+	b.update(name, func(entry *statusEntry) {
+		entry.state = StatePending
+		entry.attempt = 0
+		entry.restarts++
+	})
+}
+
+// drain records that shutdown has begun for a running service.
+func (b *statusBoard) drain(name string) {
+	b.update(name, func(entry *statusEntry) {
+		entry.draining = true
+	})
+}
+
+// transition moves a service to state. A failure stays visible
+// through shutdown, and only a starting service can become ready.
+func (b *statusBoard) transition(name string, state State) {
+	b.update(name, func(entry *statusEntry) {
+		switch {
+		case entry.state == StateFailed,
+			entry.state == StateAllowedFailed:
+			return
+		case state == StateReady && entry.state != StateStarting:
+			return
+		}
+
+		entry.state = state
+	})
+}
+
+func (b *statusBoard) snapshot(now time.Time) []ServiceStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	statuses := make([]ServiceStatus, 0, len(b.entries))
+
+	for name, entry := range b.entries {
+		status := ServiceStatus{
+			Name:      name,
+			State:     entry.current(),
+			Attempt:   entry.attempt,
+			LastError: entry.lastErr,
+			StartedAt: entry.startedAt,
+			Restarts:  entry.restarts,
+			Group:     entry.group,
+			Health:    entry.health(),
+
+			AllowedFailure: entry.allowed,
+			NextRun:        entry.nextRun,
+			LastExecution:  entry.lastExec,
+		}
+
+		switch entry.state {
+		case StateStarting, StateReady, StateRunning:
+			status.Uptime = now.Sub(entry.startedAt)
+		default:
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	slices.SortFunc(statuses, func(a, b ServiceStatus) int {
+		return cmp.Or(
+			cmp.Compare(a.Group, b.Group),
+			cmp.Compare(a.Name, b.Name),
+		)
+	})
+
+	return statuses
+}
+
+// current is the state the service shows: one that still runs
+// while it drains shows as draining until it is stopped.
+func (e *statusEntry) current() State {
+	switch e.state {
+	case StatePending, StateStarting, StateReady, StateRunning,
+		StateScheduled, StateRetrying:
+		if e.draining {
+			return StateDraining
+		}
+	case StateDraining, StateFailed, StateAllowedFailed,
+		StateStopping, StateStopped:
+	}
+
+	return e.state
+}
+
+// health is how well the service works in its current state.
+func (e *statusEntry) health() ServiceHealth {
+	state := e.current()
+
+	switch state {
+	case StateRunning, StateReady:
+		if e.checked.State != "" {
+			return e.checked
+		}
+
+		return ServiceHealth{State: HealthOK}
+	case StateScheduled:
+		if e.lastExec.Err != nil {
+			return ServiceHealth{
+				State:  HealthDegraded,
+				Reason: fmt.Sprintf("last run failed: %v", e.lastExec.Err),
+			}
+		}
+
+		if e.checked.State != "" {
+			return e.checked
+		}
+
+		return ServiceHealth{State: HealthOK}
+	case StateStopped:
+		return ServiceHealth{State: HealthOK}
+	case StatePending, StateRetrying, StateFailed, StateAllowedFailed:
+		if e.lastErr != nil {
+			return ServiceHealth{
+				State:  HealthUnhealthy,
+				Reason: fmt.Sprintf("%s: %v", e.state, e.lastErr),
+			}
+		}
+	case StateStarting, StateDraining, StateStopping:
+	}
+
+	return ServiceHealth{State: HealthUnhealthy, Reason: string(state)}
+}
+
+// attemptState is the state a service enters when Run is called:
+// a service that reports readiness is starting until it has.
+func attemptState(service Service) State {
+	rn, ok := service.(ReadyNotifier)
+	if !ok {
+		return StateRunning
+	}
+
+	select {
+	case <-rn.Ready():
+		return StateReady
+	default:
+		return StateStarting
+	}
+}
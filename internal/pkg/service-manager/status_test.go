@@ -0,0 +1,113 @@
+package servicemanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitForState blocks until name reports want and returns that
+// status.
+func waitForState(
+	t *testing.T,
+	sm *ServiceManager,
+	name string,
+	want State,
+) ServiceStatus {
+	t.Helper()
+
+	var last ServiceStatus
+
+	require.Eventually(t, func() bool {
+		for _, status := range sm.Status() {
+			if status.Name == name {
+				last = status
+
+				return status.State == want
+			}
+		}
+
+		return false
+	}, runHangGuard, startedPollInterval,
+		"%s never reached %s", name, want)
+
+	return last
+}
+
+func TestServiceManager_Status(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+	assert.Empty(t, sm.Status())
+
+	db := NewReadyMockService("db")
+	api := NewDependentMockService("api", "db")
+	flaky := NewRetryableMockService("flaky", 2).
+		WithRetryDelay(time.Hour)
+	flaky.WithRunError(errTestService)
+
+	optional := NewAllowedFailureMockService("optional")
+	optional.WithRunError(errTestService)
+
+	sm.Add(db, api, flaky, optional)
+
+	runDone, cancel := runInBackground(t, sm)
+
+	waitForState(t, sm, "db", StateStarting)
+	waitForState(t, sm, "api", StatePending)
+
+	status := waitForState(t, sm, "flaky", StateRetrying)
+	assert.Equal(t, 1, status.Attempt)
+	assert.Equal(t, 1, status.Restarts)
+	require.ErrorIs(t, status.LastError, errTestService)
+
+	status = waitForState(t, sm, "optional", StateAllowedFailed)
+	require.ErrorIs(t, status.LastError, errTestService)
+
+	db.SignalReady()
+	waitForState(t, sm, "db", StateReady)
+
+	status = waitForState(t, sm, "api", StateRunning)
+	assert.Equal(t, 1, status.Group)
+	assert.Equal(t, 1, status.Attempt)
+	assert.False(t, status.StartedAt.IsZero())
+
+	names := make([]string, 0, 4)
+	for _, status := range sm.Status() {
+		names = append(names, status.Name)
+	}
+
+	assert.Equal(t, []string{"db", "flaky", "optional", "api"}, names)
+
+	cancel()
+
+	require.NoError(t, waitForRun(t, runDone))
+
+	for _, status := range sm.Status() {
+		want := StateStopped
+		if status.Name == "optional" {
+			want = StateAllowedFailed
+		}
+
+		assert.Equal(t, want, status.State, status.Name)
+		assert.Zero(t, status.Uptime, status.Name)
+	}
+}
+
+func TestServiceManager_StatusCountsRestarts(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+	newServiceFixture(sm)
+
+	stop := runControlled(t, sm, 2)
+	defer stop()
+
+	require.NoError(t, sm.RestartService(t.Context(), "db"))
+
+	status := waitForState(t, sm, "db", StateRunning)
+	assert.Equal(t, 1, status.Restarts)
+	assert.Equal(t, 1, status.Attempt)
+}
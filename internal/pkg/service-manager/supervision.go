@@ -0,0 +1,231 @@
+package servicemanager
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/psyb0t/ctxerrors"
+	"github.com/psyb0t/ctxscope"
+)
+
+// Strategy decides which services restart together when one of
+// them is restarted after failing or exiting.
+type Strategy string
+
+const (
+	// OneForOne restarts only the service that failed, in place.
+	// It is the default.
+	OneForOne Strategy = "one-for-one"
+	// OneForAll restarts every running service along with the one
+	// that failed.
+	OneForAll Strategy = "one-for-all"
+	// RestForOne restarts the service that failed and every running
+	// service that depends on it, directly or not: the ones started
+	// after it because of it.
+	RestForOne Strategy = "rest-for-one"
+)
+
+func (st Strategy) valid() bool {
+	switch st {
+	case OneForOne, OneForAll, RestForOne:
+		return true
+	}
+
+	return false
+}
+
+// handOffRestart passes a service that is due for another attempt
+// to the supervisor, which restarts it together with the services
+// the strategy ties to it; its fresh instance takes over resumed.
+// The run is claimed here, before its goroutine returns, so neither
+// Stop nor its readiness gate treats the exit as final.
+func (s *ServiceManager) handOffRestart(
+	run *serviceRun,
+	resumed resumption,
+) {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+
+	if run.stopped || s.stopping {
+		return
+	}
+
+	run.stopped = true
+	run.handedOff = true
+
+	ctx := context.WithoutCancel(withServiceScope(s.runCtx, run.name))
+
+	s.wg.Go(func() {
+		s.restartGroup(ctx, run, resumed)
+	})
+}
+
+// restartGroup stops run and the services its strategy restarts
+// with it, in reverse dependency order, then starts fresh instances
+// of all of them behind the usual readiness gates. The failed
+// service carries its attempt count over to its new instance.
+func (s *ServiceManager) restartGroup(
+	ctx context.Context,
+	run *serviceRun,
+	resumed resumption,
+) {
+	s.controlMu.Lock()
+	defer s.controlMu.Unlock()
+
+	targets, restart := s.claimGroup(run)
+	if len(targets) == 0 {
+		return
+	}
+
+	names := runNames(targets)
+
+	if restart {
+		ctxscope.GetLogger(ctx).Info("restarting service group",
+			"strategy", s.strategy,
+			"services", names,
+		)
+	}
+
+	cause := &SiblingError{
+		Service:  run.name,
+		Err:      resumed.err,
+		sentinel: ErrRestartedWithSibling,
+	}
+
+	if err := s.stopActive(ctx, targets, cause); err != nil || !restart {
+		s.failRestart(ctx, err)
+
+		return
+	}
+
+	if err := s.checkDependencies(names); err != nil {
+		s.failRestart(ctx, err)
+
+		return
+	}
+
+	fresh, err := s.freshRuns(names)
+	if err != nil {
+		s.failRestart(ctx, err)
+
+		return
+	}
+
+	for _, f := range fresh {
+		if f.name == run.name {
+			// Its retry was already counted when it was scheduled.
+			f.resumed = resumed
+
+			continue
+		}
+
+		f.resumed = resumption{reason: RestartReasonStrategy}
+		s.status.restarted(f.name)
+	}
+
+	s.failRestart(ctx, s.startRuns(ctx, fresh))
+}
+
+// claimGroup takes run, and the services its strategy restarts
+// with it, away from Stop and from their own hand-offs. A sibling
+// that was handed off too joins this group instead of restarting
+// on its own, and one that finished for good is left alone. restart
+// is false when only run's own Stop is left to do: the manager is
+// shutting down or a control call replaced it.
+func (s *ServiceManager) claimGroup(run *serviceRun) ([]*serviceRun, bool) {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+
+	if !run.handedOff {
+		return nil, false
+	}
+
+	run.handedOff = false
+	targets := []*serviceRun{run}
+
+	if s.stopping || s.runs[run.name] != run {
+		return targets, false
+	}
+
+	for _, name := range s.restartedWith(run.name) {
+		sibling := s.runs[name]
+
+		switch {
+		case sibling.finished:
+			continue
+		case sibling.active():
+			sibling.stopped = true
+		case sibling.handedOff:
+			sibling.handedOff = false
+		default:
+			continue
+		}
+
+		targets = append(targets, sibling)
+	}
+
+	return targets, true
+}
+
+// restartedWith returns the names the strategy restarts together
+// with name. Callers hold runsMu.
+func (s *ServiceManager) restartedWith(name string) []string {
+	var names []string
+
+	switch s.strategy {
+	case OneForAll:
+		for other := range s.runs {
+			if other != name {
+				names = append(names, other)
+			}
+		}
+	case RestForOne:
+		seen := map[string]bool{name: true}
+		queue := s.dependentsOf(name)
+
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+
+			if seen[current] {
+				continue
+			}
+
+			seen[current] = true
+			names = append(names, current)
+			queue = append(queue, s.dependentsOf(current)...)
+		}
+	case OneForOne:
+	}
+
+	return names
+}
+
+// failRestart reports a group restart that could not bring its
+// services back as a terminal failure. A manager that is shutting
+// down is not a failure.
+func (s *ServiceManager) failRestart(ctx context.Context, err error) {
+	if err == nil || errors.Is(err, ErrManagerNotRunning) {
+		return
+	}
+
+	err = ctxerrors.Wrap(err, "restart service group")
+
+	ctxscope.GetLogger(ctx).Error("service group restart failed",
+		"err", err,
+	)
+
+	s.reportFailure(ctx, err)
+}
+
+func runNames(runs []*serviceRun) []string {
+	names := make([]string, 0, len(runs))
+	for _, run := range runs {
+		names = append(names, run.name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
@@ -0,0 +1,120 @@
+package servicemanager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceManager_Strategies(t *testing.T) {
+	testCases := []struct {
+		strategy Strategy
+		want     map[string]int
+	}{
+		{OneForOne, map[string]int{"db": 1, "api": 1, "cache": 1}},
+		{OneForAll, map[string]int{"db": 2, "api": 2, "cache": 2}},
+		{RestForOne, map[string]int{"db": 2, "api": 2, "cache": 1}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.strategy), func(t *testing.T) {
+			t.Setenv("SERVICEMANAGER_STRATEGY", string(tc.strategy))
+
+			ResetInstance()
+
+			sm := GetInstance()
+			f := newServiceFixture(sm)
+			f.register("cache")
+
+			stop := runControlled(t, sm, 3)
+			defer stop()
+
+			close(f.crash)
+
+			require.Eventually(t, func() bool {
+				for _, status := range sm.Status() {
+					if status.Name == "db" {
+						return status.Attempt == 2 &&
+							status.State == StateRunning
+					}
+				}
+
+				return false
+			}, runHangGuard, startedPollInterval)
+
+			waitForStartedServices(t, sm, 3)
+
+			for _, name := range []string{"api", "cache"} {
+				waitForState(t, sm, name, StateRunning)
+			}
+
+			built, _ := f.snapshot()
+			assert.Equal(t, tc.want, built)
+		})
+	}
+}
+
+func TestServiceManager_StrategiesSkipFinishedJobs(t *testing.T) {
+	for _, strategy := range []Strategy{OneForAll, RestForOne} {
+		t.Run(string(strategy), func(t *testing.T) {
+			t.Setenv("SERVICEMANAGER_STRATEGY", string(strategy))
+
+			ResetInstance()
+
+			sm := GetInstance()
+			f := newServiceFixture(sm)
+			job := &jobService{
+				Service: NewTestService("migrate"),
+				deps:    []string{"db"},
+			}
+			sm.Register("migrate", func() (Service, error) {
+				f.recordBuild("migrate")
+
+				return job, nil
+			})
+
+			stop := runControlled(t, sm, 2)
+			defer stop()
+
+			require.Eventually(t, func() bool {
+				sm.runsMu.Lock()
+				defer sm.runsMu.Unlock()
+
+				return sm.runs["migrate"].finished
+			}, runHangGuard, startedPollInterval)
+
+			close(f.crash)
+
+			require.Eventually(t, func() bool {
+				for _, status := range sm.Status() {
+					if status.Name == "db" {
+						return status.Attempt == 2 &&
+							status.State == StateRunning
+					}
+				}
+
+				return false
+			}, runHangGuard, startedPollInterval)
+
+			waitForState(t, sm, "api", StateRunning)
+
+			built, _ := f.snapshot()
+			assert.Equal(t, 1, built["migrate"])
+			assert.Equal(t, int32(1), job.runs.Load())
+		})
+	}
+}
+
+func TestServiceManager_UnknownStrategy(t *testing.T) {
+	t.Setenv("SERVICEMANAGER_STRATEGY", "one-for-some")
+
+	ResetInstance()
+
+	sm := GetInstance()
+	sm.Add(NewTestService("svc"))
+
+	err := sm.Run(t.Context())
+	require.ErrorIs(t, err, ErrUnknownStrategy)
+	require.ErrorIs(t, err, ErrInvalidConfig)
+}
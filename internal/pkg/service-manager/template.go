@@ -0,0 +1,276 @@
+package servicemanager
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/psyb0t/ctxerrors"
+	"github.com/psyb0t/gonfiguration"
+)
+
+// templateSeparator joins the name of a templated service and the
+// name of one of its instances, as in consumer@orders.
+const templateSeparator = "@"
+
+const scopeKeyInstance = "instance"
+
+// Instance is one instance of a templated service, such as
+// consumer@orders, handed to its TemplateFactory.
+type Instance struct {
+	// Template is the name the factory is registered under.
+	Template string
+	// Name is the instance part of the service name.
+	Name string
+}
+
+// ServiceName is the name the instance runs, logs and is depended
+// upon as: Template@Name.
+func (i Instance) ServiceName() string {
+	return i.Template + templateSeparator + i.Name
+}
+
+// EnvPrefix is the prefix of the env vars that configure only this
+// instance: the service name upper-cased, with every character
+// other than a letter or a digit turned into an underscore, and a
+// trailing underscore. consumer@orders reads CONSUMER_ORDERS_.
+func (i Instance) EnvPrefix() string {
+	prefix := strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII ||
+			!unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return '_'
+		}
+
+		return unicode.ToUpper(r)
+	}, i.ServiceName())
+
+	return prefix + "_"
+}
+
+// ParseConfig fills dst, a pointer to a struct with env tags, as
+// gonfiguration.Parse does, except that a variable set under
+// EnvPrefix takes precedence over the unprefixed one: with both
+// CONSUMER_ORDERS_QUEUE and QUEUE set, the instance reads the
+// former. Settings shared by all instances keep plain names. The
+// fields of embedded structs are filled too; an env tag on an
+// unexported field, or an embedded pointer, is an ErrInvalidConfig.
+func (i Instance) ParseConfig(dst any) error {
+	ptr := reflect.ValueOf(dst)
+	if ptr.Kind() != reflect.Pointer || ptr.Elem().Kind() != reflect.Struct {
+		return ctxerrors.Wrap(gonfiguration.Parse(dst), "parse config")
+	}
+
+	target := ptr.Elem()
+
+	fields, paths, err := configFields(target.Type(), nil, i.EnvPrefix())
+	if err != nil {
+		return ctxerrors.Wrapf(err, "parse config of %s", i.ServiceName())
+	}
+
+	shadow := reflect.New(reflect.StructOf(fields))
+	if err := gonfiguration.Parse(shadow.Interface()); err != nil {
+		return ctxerrors.Wrapf(
+			errors.Join(ErrInvalidConfig, err),
+			"parse config of %s", i.ServiceName(),
+		)
+	}
+
+	for j, path := range paths {
+		target.FieldByIndex(path).Set(shadow.Elem().Field(j))
+	}
+
+	return nil
+}
+
+// configFields flattens the env-tagged fields of typ, those of its
+// embedded structs included, into the fields of a struct
+// gonfiguration can parse, each tag pointed at the prefixed
+// variable when that one is set. paths holds where each field
+// lives in typ, below index.
+func configFields(
+	typ reflect.Type,
+	index []int,
+	prefix string,
+) ([]reflect.StructField, [][]int, error) {
+	var (
+		fields []reflect.StructField
+		paths  [][]int
+	)
+
+	for idx := range typ.NumField() {
+		field := typ.Field(idx)
+		path := append(slices.Clone(index), idx)
+
+		tag, ok := field.Tag.Lookup("env")
+
+		switch {
+		case !ok && field.Anonymous && field.Type.Kind() == reflect.Struct:
+			nested, nestedPaths, err := configFields(field.Type, path, prefix)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			fields = append(fields, nested...)
+			paths = append(paths, nestedPaths...)
+
+			continue
+		case !ok && field.Anonymous && field.Type.Kind() == reflect.Pointer:
+			return nil, nil, ctxerrors.Wrapf(
+				ErrInvalidConfig, "embedded pointer %s", field.Name,
+			)
+		case !ok:
+			continue
+		case !field.IsExported():
+			return nil, nil, ctxerrors.Wrapf(
+				ErrInvalidConfig, "env tag on unexported field %s", field.Name,
+			)
+		}
+
+		key, opts, _ := strings.Cut(tag, ",")
+		key = strings.TrimSpace(key)
+
+		if _, set := os.LookupEnv(prefix + key); set {
+			prefixed := prefix + key
+			if opts != "" {
+				prefixed += "," + opts
+			}
+
+			field.Tag = reflect.StructTag(strings.Replace(
+				string(field.Tag),
+				"env:"+strconv.Quote(tag),
+				"env:"+strconv.Quote(prefixed),
+				1,
+			))
+		}
+
+		// Embedded and promoted fields may share a name; the flat
+		// struct only needs them in order.
+		field.Name = "Field" + strconv.Itoa(len(fields))
+		field.PkgPath = ""
+		field.Anonymous = false
+		field.Index = nil
+		field.Offset = 0
+		fields = append(fields, field)
+		paths = append(paths, path)
+	}
+
+	return fields, paths, nil
+}
+
+// TemplateFactory creates the instance of a templated service
+// named by instance.
+type TemplateFactory func(instance Instance) (Service, error)
+
+// RegisterTemplate stores a factory for a templated service. It
+// runs no instance by itself: SERVICES_ENABLED names the instances
+// to run, as name@instance, and each one is built by calling
+// factory with its Instance.
+func (s *ServiceManager) RegisterTemplate(
+	name string,
+	factory TemplateFactory,
+) {
+	s.factoriesMu.Lock()
+	defer s.factoriesMu.Unlock()
+
+	if s.templates == nil {
+		s.templates = make(map[string]TemplateFactory)
+	}
+
+	s.templates[name] = factory
+}
+
+// parseInstance splits name into a registered template and an
+// instance of it. Callers hold factoriesMu.
+func (s *ServiceManager) parseInstance(
+	name string,
+) (Instance, TemplateFactory, bool) {
+	template, instance, ok := strings.Cut(name, templateSeparator)
+	if !ok {
+		return Instance{}, nil, false
+	}
+
+	factory, ok := s.templates[template]
+	if !ok {
+		return Instance{}, nil, false
+	}
+
+	return Instance{Template: template, Name: instance}, factory, true
+}
+
+// factoryFor returns the factory that builds the service name: the
+// one registered under it, the one of its replica set for a
+// replica, or its template for a templated instance. Callers hold
+// factoriesMu.
+func (s *ServiceManager) factoryFor(name string) (ServiceFactory, bool) {
+	if factory, ok := s.factories[name]; ok {
+		return factory, true
+	}
+
+	if base, _, replica := strings.Cut(name, replicaSeparator); replica {
+		return s.factoryFor(base)
+	}
+
+	instance, factory, ok := s.parseInstance(name)
+	if !ok || instance.Name == "" {
+		return nil, false
+	}
+
+	return func() (Service, error) { return factory(instance) }, true
+}
+
+// templateInstances returns, in order, the names of the enabled
+// instances of registered templates, failing for one without an
+// instance name. Callers hold factoriesMu.
+func (s *ServiceManager) templateInstances(enabled []string) ([]string, error) {
+	var names []string
+
+	for _, name := range enabled {
+		instance, _, ok := s.parseInstance(name)
+		if !ok {
+			continue
+		}
+
+		if instance.Name == "" ||
+			strings.Contains(instance.Name, replicaSeparator) {
+			return nil, ctxerrors.Wrapf(
+				ErrInvalidConfig,
+				"%s: bad instance %q", envVarNameServicesEnabled, name,
+			)
+		}
+
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+// templateInstanceNames returns, sorted, the keys of m that are
+// instances of the template name, replicas included.
+func templateInstanceNames[V any](m map[string]V, name string) []string {
+	var names []string
+
+	for key := range m {
+		if strings.HasPrefix(key, name+templateSeparator) {
+			names = append(names, key)
+		}
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// instanceOf returns the instance part of the service name, without
+// a replica suffix, and whether it names a templated instance.
+func instanceOf(name string) (string, bool) {
+	_, instance, ok := strings.Cut(name, templateSeparator)
+	instance, _, _ = strings.Cut(instance, replicaSeparator)
+
+	return instance, ok
+}
@@ -0,0 +1,230 @@
+package servicemanager
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/psyb0t/ctxscope"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// registerConsumer registers the consumer template and returns the
+// instances its factory was called with.
+func registerConsumer(sm *ServiceManager) func() []Instance {
+	var (
+		mu        sync.Mutex
+		instances []Instance
+	)
+
+	sm.RegisterTemplate("consumer", func(instance Instance) (Service, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		instances = append(instances, instance)
+
+		return NewTestService(instance.ServiceName()), nil
+	})
+
+	return func() []Instance {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return instances
+	}
+}
+
+func TestServiceManager_TemplateInstances(t *testing.T) {
+	t.Setenv("SERVICES_ENABLED", "consumer@orders,consumer@billing,api,audit")
+
+	ResetInstance()
+
+	sm := GetInstance()
+
+	instances := registerConsumer(sm)
+	sm.Register("api", func() (Service, error) {
+		return newLossRecordingService("api", "", "consumer@orders"), nil
+	})
+	sm.Register("audit", func() (Service, error) {
+		return newLossRecordingService("audit", "", "consumer"), nil
+	})
+
+	runDone, cancel := runInBackground(t, sm)
+
+	api := waitForState(t, sm, "api", StateRunning)
+	audit := waitForState(t, sm, "audit", StateRunning)
+
+	assert.Equal(t, []string{
+		"consumer@billing", "consumer@orders", "api", "audit",
+	}, statusNames(sm))
+	assert.Equal(t, 1, api.Group)
+	assert.Equal(t, 1, audit.Group)
+	assert.ElementsMatch(t, []Instance{
+		{Template: "consumer", Name: "orders"},
+		{Template: "consumer", Name: "billing"},
+	}, instances())
+
+	sm.runsMu.Lock()
+	assert.Equal(t, []string{"consumer@orders"}, sm.runs["api"].deps)
+	assert.ElementsMatch(t,
+		[]string{"consumer@billing", "consumer@orders"},
+		sm.runs["audit"].deps,
+	)
+	sm.runsMu.Unlock()
+
+	// A restart builds the instance from its template again.
+	require.NoError(t, sm.RestartService(t.Context(), "consumer@orders"))
+	assert.Len(t, instances(), 3)
+
+	cancel()
+	require.NoError(t, waitForRun(t, runDone))
+}
+
+func TestServiceManager_TemplateWithoutInstances(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+	instances := registerConsumer(sm)
+
+	runDone, cancel := runInBackground(t, sm)
+	defer cancel()
+
+	require.ErrorIs(t, waitForRun(t, runDone), ErrNoEnabledServices)
+	assert.Empty(t, instances())
+}
+
+func TestServiceManager_TemplateBadInstance(t *testing.T) {
+	t.Setenv("SERVICES_ENABLED", "consumer@")
+
+	ResetInstance()
+
+	sm := GetInstance()
+	registerConsumer(sm)
+
+	require.ErrorIs(t, sm.Run(t.Context()), ErrInvalidConfig)
+}
+
+func TestServiceManager_TemplateInstantiate(t *testing.T) {
+	ResetInstance()
+
+	sm := GetInstance()
+	registerConsumer(sm)
+
+	svc, err := sm.Instantiate("consumer@orders")
+	require.NoError(t, err)
+	assert.Equal(t, "consumer@orders", svc.Name())
+
+	_, err = sm.Instantiate("consumer@")
+	require.ErrorIs(t, err, ErrServiceNotFound)
+}
+
+func TestWithServiceScope_Instance(t *testing.T) {
+	scope := ctxscope.Get(withServiceScope(t.Context(), "consumer@orders#1"))
+
+	assert.Equal(t, "consumer@orders#1", scope[scopeKeyService])
+	assert.Equal(t, "orders", scope[scopeKeyInstance])
+
+	scope = ctxscope.Get(withServiceScope(t.Context(), "api"))
+	assert.NotContains(t, scope, scopeKeyInstance)
+}
+
+func TestInstance_EnvPrefix(t *testing.T) {
+	testCases := []struct {
+		instance Instance
+		want     string
+	}{
+		{
+			instance: Instance{Template: "consumer", Name: "orders"},
+			want:     "CONSUMER_ORDERS_",
+		},
+		{
+			instance: Instance{Template: "price-worker", Name: "eu.west-1"},
+			want:     "PRICE_WORKER_EU_WEST_1_",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.want, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.instance.EnvPrefix())
+		})
+	}
+}
+
+func TestInstance_ParseConfig(t *testing.T) {
+	type consumerConfig struct {
+		Queue   string        `env:"QUEUE,required"`
+		Broker  string        `env:"BROKER" default:"nats://localhost"`
+		Timeout time.Duration `env:"TIMEOUT"`
+		local   string
+	}
+
+	orders := Instance{Template: "consumer", Name: "orders"}
+
+	t.Setenv("CONSUMER_ORDERS_QUEUE", "orders.v1")
+	t.Setenv("CONSUMER_BILLING_QUEUE", "billing.v1")
+	t.Setenv("TIMEOUT", "5s")
+	t.Setenv("CONSUMER_ORDERS_TIMEOUT", "2s")
+
+	cfg := consumerConfig{local: "kept"}
+	require.NoError(t, orders.ParseConfig(&cfg))
+
+	assert.Equal(t, consumerConfig{
+		Queue:   "orders.v1",
+		Broker:  "nats://localhost",
+		Timeout: 2 * time.Second,
+		local:   "kept",
+	}, cfg)
+
+	shared := Instance{Template: "consumer", Name: "audit"}
+	require.ErrorIs(t, shared.ParseConfig(&consumerConfig{}), ErrInvalidConfig)
+}
+
+func TestInstance_ParseConfigEmbedded(t *testing.T) {
+	type brokerConfig struct {
+		Broker string `env:"BROKER" default:"nats://localhost"`
+		Queue  string `env:"QUEUE"`
+	}
+
+	type consumerConfig struct {
+		brokerConfig
+
+		Queue string `env:"QUEUE"`
+		Batch int    `env:"BATCH"`
+	}
+
+	orders := Instance{Template: "consumer", Name: "orders"}
+
+	t.Setenv("CONSUMER_ORDERS_BROKER", "nats://orders")
+	t.Setenv("QUEUE", "shared")
+	t.Setenv("CONSUMER_ORDERS_BATCH", "10")
+
+	var cfg consumerConfig
+	require.NoError(t, orders.ParseConfig(&cfg))
+
+	assert.Equal(t, consumerConfig{
+		brokerConfig: brokerConfig{Broker: "nats://orders", Queue: "shared"},
+		Queue:        "shared",
+		Batch:        10,
+	}, cfg)
+}
+
+func TestInstance_ParseConfigUnhandledFields(t *testing.T) {
+	type brokerConfig struct {
+		Broker string `env:"BROKER"`
+	}
+
+	type unexported struct {
+		queue string `env:"QUEUE"`
+	}
+
+	type embeddedPointer struct {
+		*brokerConfig
+	}
+
+	orders := Instance{Template: "consumer", Name: "orders"}
+
+	for _, dst := range []any{&unexported{}, &embeddedPointer{}} {
+		require.ErrorIs(t, orders.ParseConfig(dst), ErrInvalidConfig)
+	}
+}
@@ -13,9 +13,10 @@ const ServiceName = "example-api"
 
 // ExampleAPI demonstrates dependency behavior.
 // It depends on "example-database" and "example-flaky"
-// so it only starts after both are running. This shows
-// how the API waits for the flaky service to recover
-// from its retries before starting.
+// so it only starts after both are running. Each time
+// the flaky service fails, the API's context is
+// cancelled and it waits for the next retry to come up
+// before it runs again.
 type ExampleAPI struct{}
 
 func New() (*ExampleAPI, error) {
@@ -3,29 +3,22 @@ package exampleflaky
 import (
 	"context"
 	"errors"
-	"os"
-	"strconv"
 	"time"
 
 	"github.com/psyb0t/ctxerrors"
 	"github.com/psyb0t/ctxscope"
+	servicemanager "github.com/psyb0t/servicepack/internal/pkg/service-manager"
 )
 
 const ServiceName = "example-flaky"
 
 var errFlaky = errors.New("flaky failure")
 
-const (
-	attemptsFile     = "/tmp/example-flaky-attempts"
-	attemptsFileMode = 0o644
-	maxRetries       = 2
-)
+const maxRetries = 2
 
-// ExampleFlaky demonstrates retry behavior with state.
-// It tracks how many times it has been called in a temp
-// file. It fails on the first attempts and succeeds on
-// the last retry. On success it cleans up the temp file
-// so the next run starts fresh.
+// ExampleFlaky demonstrates retry behavior. It reads which attempt
+// it is on from the context the service manager passes to Run,
+// fails on the first attempts and succeeds on the last retry.
 type ExampleFlaky struct{}
 
 func New() (*ExampleFlaky, error) {
@@ -52,36 +45,31 @@ func (f *ExampleFlaky) Run(
 	ctx = ctxscope.Set(ctx, ctxscope.Attr("service", ServiceName))
 	logger := ctxscope.GetLogger(ctx)
 
-	attempt := readAttempts(ctx) + 1
-	if err := writeAttempts(attempt); err != nil {
-		return ctxerrors.Wrap(err, "write attempt count")
-	}
+	info, _ := servicemanager.RuntimeInfoFromContext(ctx)
 
 	logger.Info("starting service",
-		"attempt", attempt,
-		"max_attempts", maxRetries+1,
+		"attempt", info.Attempt,
+		"max_attempts", info.MaxRetries+1,
+		"restart_reason", info.RestartReason,
+		"prev_err", info.PrevErr,
 	)
 
-	if attempt <= maxRetries {
+	if info.Attempt <= info.MaxRetries {
 		logger.Warn("simulating failure",
-			"attempt", attempt,
+			"attempt", info.Attempt,
 		)
 
 		return ctxerrors.Wrapf(
 			errFlaky,
 			"attempt %d/%d",
-			attempt, maxRetries+1,
+			info.Attempt, info.MaxRetries+1,
 		)
 	}
 
 	logger.Info("finally stable",
-		"attempt", attempt,
+		"attempt", info.Attempt,
 	)
 
-	if err := cleanupAttempts(); err != nil {
-		return ctxerrors.Wrap(err, "clean up attempt count")
-	}
-
 	ticker := time.NewTicker(10 * time.Second) //nolint:mnd
 	defer ticker.Stop()
 
@@ -104,58 +92,5 @@ func (f *ExampleFlaky) Stop(
 
 	ctxscope.GetLogger(serviceCtx).Info("stopping service")
 
-	if err := cleanupAttempts(); err != nil {
-		return ctxerrors.Wrap(err, "clean up attempt count")
-	}
-
-	return nil
-}
-
-func readAttempts(ctx context.Context) int {
-	data, err := os.ReadFile(attemptsFile)
-	if err != nil {
-		if !errors.Is(err, os.ErrNotExist) {
-			ctxscope.GetLogger(ctx).Warn(
-				"read attempt count failed",
-				"err", err,
-			)
-		}
-
-		return 0
-	}
-
-	n, err := strconv.Atoi(string(data))
-	if err != nil {
-		ctxscope.GetLogger(ctx).Warn("parse attempt count failed", "err", err)
-
-		return 0
-	}
-
-	return n
-}
-
-func writeAttempts(n int) error {
-	// This example service persists a restart-surviving attempt counter at a
-	// FIXED path on purpose so readAttempts and cleanupAttempts can find it
-	// again; a random os.CreateTemp name would defeat that. Demo code, not a
-	// real attack surface.
-	// nosemgrep: go.lang.security.bad_tmp.bad-tmp-file-creation
-	if err := os.WriteFile(
-		attemptsFile,
-		[]byte(strconv.Itoa(n)),
-		attemptsFileMode,
-	); err != nil {
-		return ctxerrors.Wrap(err, "write attempts file")
-	}
-
-	return nil
-}
-
-func cleanupAttempts() error {
-	err := os.Remove(attemptsFile)
-	if err != nil && !errors.Is(err, os.ErrNotExist) {
-		return ctxerrors.Wrap(err, "remove attempts file")
-	}
-
 	return nil
 }
@@ -0,0 +1,62 @@
+package examplescheduled
+
+import (
+	"context"
+	"time"
+
+	"github.com/psyb0t/ctxscope"
+	servicemanager "github.com/psyb0t/servicepack/internal/pkg/service-manager"
+)
+
+const ServiceName = "example-scheduled"
+
+// ExampleScheduled demonstrates a scheduled service. Instead of
+// running a ticker loop of its own, it implements Scheduled and
+// the service manager calls Run every time the schedule is due.
+// A failed run is retried as Retryable says and never ends the
+// schedule. Useful for cleanups, reports and syncs.
+type ExampleScheduled struct{}
+
+func New() (*ExampleScheduled, error) {
+	return &ExampleScheduled{}, nil
+}
+
+func (e *ExampleScheduled) Name() string {
+	return ServiceName
+}
+
+// Schedule makes ExampleScheduled implement the Scheduled
+// interface. It runs every 15 seconds, a little later on some
+// runs, and drops a run that is due while the last one still runs.
+func (e *ExampleScheduled) Schedule() servicemanager.Schedule {
+	return servicemanager.Schedule{
+		Every:   15 * time.Second, //nolint:mnd
+		Overlap: servicemanager.OverlapSkip,
+		Jitter:  time.Second,
+	}
+}
+
+func (e *ExampleScheduled) Run(
+	ctx context.Context,
+) error {
+	ctx = ctxscope.Set(ctx, ctxscope.Attr("service", ServiceName))
+
+	info, _ := servicemanager.RuntimeInfoFromContext(ctx)
+
+	ctxscope.GetLogger(ctx).Info("cleaning up",
+		"scheduled_at", info.ScheduledAt,
+		"attempt", info.Attempt,
+	)
+
+	return nil
+}
+
+func (e *ExampleScheduled) Stop(
+	ctx context.Context,
+) error {
+	serviceCtx := ctxscope.Set(ctx, ctxscope.Attr("service", ServiceName))
+
+	ctxscope.GetLogger(serviceCtx).Info("stopping service")
+
+	return nil
+}
@@ -12,6 +12,7 @@ import (
 	examplenestedgrpc "github.com/psyb0t/servicepack/internal/pkg/services/example-nested/grpc"
 	examplenestedhttp "github.com/psyb0t/servicepack/internal/pkg/services/example-nested/http"
 	exampleoptional "github.com/psyb0t/servicepack/internal/pkg/services/example-optional"
+	examplescheduled "github.com/psyb0t/servicepack/internal/pkg/services/example-scheduled"
 	helloworld "github.com/psyb0t/servicepack/internal/pkg/services/hello-world"
 )
 
@@ -50,6 +51,10 @@ func Init() {
 		return exampleoptional.New()
 	})
 
+	sm.Register(examplescheduled.ServiceName, func() (servicemanager.Service, error) {
+		return examplescheduled.New()
+	})
+
 	sm.Register(helloworld.ServiceName, func() (servicemanager.Service, error) {
 		return helloworld.New()
 	})
@@ -14,7 +14,26 @@ import (
 	"github.com/psyb0t/gonfiguration"
 )
 
-var ErrShutdownTimeout = errors.New("shutdown timeout")
+var (
+	ErrShutdownTimeout = errors.New("shutdown timeout")
+	ErrInvalidConfig   = errors.New("invalid runner configuration")
+	ErrSignal          = errors.New("received shutdown signal")
+)
+
+// SignalError is the cause of the application context's
+// cancellation when the runner receives a shutdown signal. It
+// matches ErrSignal.
+type SignalError struct {
+	Signal os.Signal
+}
+
+func (e *SignalError) Error() string {
+	return ErrSignal.Error() + ": " + e.Signal.String()
+}
+
+func (e *SignalError) Is(target error) bool {
+	return target == ErrSignal
+}
 
 type Runnable interface {
 	Run(ctx context.Context) error
@@ -36,12 +55,13 @@ func RunContext(ctx context.Context, runnable Runnable) error {
 		return ctxerrors.Wrap(err, "get runner config")
 	}
 
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
 
 	r := &appRunner{
 		runnable:        runnable,
 		shutdownTimeout: cfg.ShutdownTimeout,
+		cancel:          cancel,
 	}
 
 	return r.run(ctx)
@@ -50,6 +70,7 @@ func RunContext(ctx context.Context, runnable Runnable) error {
 type appRunner struct {
 	runnable        Runnable
 	shutdownTimeout time.Duration
+	cancel          context.CancelCauseFunc
 }
 
 func getConfig() (*config, error) {
@@ -57,7 +78,8 @@ func getConfig() (*config, error) {
 
 	if err := gonfiguration.Parse(cfg); err != nil {
 		return nil, ctxerrors.Wrap(
-			err, "failed to parse runner config",
+			errors.Join(ErrInvalidConfig, err),
+			"failed to parse runner config",
 		)
 	}
 
@@ -123,6 +145,10 @@ func (r *appRunner) waitForShutdown(
 			"signal", sig.String(),
 		)
 
+		// The application sees why it is being stopped through
+		// context.Cause before Stop is called.
+		r.cancel(&SignalError{Signal: sig})
+
 		return nil
 	case err := <-errCh:
 		// The wrap stays inside the non-nil branch: ctxerrors logs an ERROR of
@@ -170,18 +196,33 @@ func (r *appRunner) gracefulShutdown(
 
 	select {
 	case err := <-stopErrCh:
-		return ctxerrors.Wrap(errors.Join(shutdownErr, err), "stop application")
+		return stopFailed(shutdownErr, err)
 	case <-shutdownCtx.Done():
 		return r.handleShutdownTimeout(
 			shutdownCtx, shutdownErr,
 		)
 	case <-doneCh:
-		ctxscope.GetLogger(ctx).Info("shutdown completed")
 	}
 
+	// Stop returns before doneCh closes, so its error is already
+	// buffered when select happened to pick doneCh.
+	select {
+	case err := <-stopErrCh:
+		return stopFailed(shutdownErr, err)
+	default:
+	}
+
+	ctxscope.GetLogger(ctx).Info("shutdown completed")
+
 	return shutdownErr
 }
 
+func stopFailed(shutdownErr, stopErr error) error {
+	return ctxerrors.Wrap(
+		errors.Join(shutdownErr, stopErr), "stop application",
+	)
+}
+
 func (r *appRunner) handleShutdownTimeout(
 	shutdownCtx context.Context,
 	shutdownErr error,
@@ -59,6 +59,23 @@ func TestRun_CleanExit(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+var errStop = errors.New("stop error")
+
+func TestRun_StopError(t *testing.T) {
+	for range 20 {
+		r := &mockRunnable{
+			runFunc: func(_ context.Context) error {
+				return nil
+			},
+			stopFunc: func(_ context.Context) error {
+				return errStop
+			},
+		}
+
+		require.ErrorIs(t, Run(r), errStop)
+	}
+}
+
 func TestGetConfig(t *testing.T) {
 	cfg, err := getConfig()
 	require.NoError(t, err)
@@ -77,6 +94,13 @@ func TestGetConfig_Custom(t *testing.T) {
 	assert.Equal(t, expected, cfg.ShutdownTimeout)
 }
 
+func TestGetConfig_Invalid(t *testing.T) {
+	t.Setenv("RUNNER_SHUTDOWNTIMEOUT", "soon")
+
+	_, err := getConfig()
+	require.ErrorIs(t, err, ErrInvalidConfig)
+}
+
 func TestHandleShutdownTimeout_DeadlineExceeded(
 	t *testing.T,
 ) {
@@ -119,15 +143,25 @@ func TestHandleShutdownTimeout_NilCtxErr(
 }
 
 func TestWaitForShutdown_Signal(t *testing.T) {
-	r := &appRunner{}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	r := &appRunner{cancel: cancel}
 
 	sigCh := make(chan os.Signal, 1)
 	errCh := make(chan error, 1)
 
 	sigCh <- syscall.SIGTERM
 
-	err := r.waitForShutdown(context.Background(), sigCh, errCh)
+	err := r.waitForShutdown(ctx, sigCh, errCh)
 	assert.NoError(t, err)
+
+	cause := context.Cause(ctx)
+	require.ErrorIs(t, cause, ErrSignal)
+
+	var sigErr *SignalError
+	require.ErrorAs(t, cause, &sigErr)
+	assert.Equal(t, syscall.SIGTERM, sigErr.Signal)
 }
 
 func TestWaitForShutdown_Error(t *testing.T) {